@@ -0,0 +1,265 @@
+// SPDX-FileCopyrightText: 2024 Peter Magnusson <me@kmpm.se>
+// SPDX-License-Identifier: MIT
+
+package glesys
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/libdns/glesys/internal/impl"
+	"github.com/libdns/libdns"
+)
+
+// SnapshotVersion is the version of the snapshot format written by
+// WriteSnapshot. ReadSnapshot accepts this version and older ones.
+const SnapshotVersion = 1
+
+// Snapshot is a backup of the records and SOA values of a zone.
+// Times are in seconds.
+type Snapshot struct {
+	Version int              `json:"version"`
+	Zone    string           `json:"zone"`
+	TakenAt time.Time        `json:"taken_at"`
+	SOA     SnapshotSOA      `json:"soa"`
+	Records []SnapshotRecord `json:"records"`
+}
+
+// SnapshotSOA are the SOA values of a zone in a Snapshot.
+type SnapshotSOA struct {
+	PrimaryNameServer string `json:"primary_nameserver"`
+	ResponsiblePerson string `json:"responsible_person"`
+	TTL               int    `json:"ttl"`
+	Refresh           int    `json:"refresh"`
+	Retry             int    `json:"retry"`
+	Expire            int    `json:"expire"`
+	Minimum           int    `json:"minimum"`
+}
+
+// SnapshotRecord is a record in a Snapshot. The ID is kept for reference
+// only, GleSYS gives restored records new IDs.
+type SnapshotRecord struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+	Type string `json:"type"`
+	TTL  int    `json:"ttl"`
+	Data string `json:"data"`
+}
+
+func (s SnapshotSOA) soa() SOA {
+	return SOA{
+		PrimaryNameServer: s.PrimaryNameServer,
+		ResponsiblePerson: s.ResponsiblePerson,
+		TTL:               time.Duration(s.TTL) * time.Second,
+		Refresh:           time.Duration(s.Refresh) * time.Second,
+		Retry:             time.Duration(s.Retry) * time.Second,
+		Expire:            time.Duration(s.Expire) * time.Second,
+		Minimum:           time.Duration(s.Minimum) * time.Second,
+	}
+}
+
+// WriteSnapshot writes the snapshot as indented JSON.
+func WriteSnapshot(w io.Writer, s *Snapshot) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(s)
+}
+
+// ReadSnapshot reads a snapshot written by WriteSnapshot.
+func ReadSnapshot(r io.Reader) (*Snapshot, error) {
+	s := &Snapshot{}
+	if err := json.NewDecoder(r).Decode(s); err != nil {
+		return nil, fmt.Errorf("failed to read snapshot: %w", err)
+	}
+	if s.Version < 1 || s.Version > SnapshotVersion {
+		return nil, fmt.Errorf("failed to read snapshot: unsupported version %d", s.Version)
+	}
+	if s.Zone == "" {
+		return nil, fmt.Errorf("failed to read snapshot: no zone")
+	}
+	return s, nil
+}
+
+// Backup takes a snapshot of the records and SOA values of the zone.
+func (p *Provider) Backup(ctx context.Context, zone string) (*Snapshot, error) {
+	ctx, span := p.startSpan(ctx, "Backup", zone, nil)
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	s, err := p.backup(ctx, zone)
+	endSpan(span, nil, err)
+	return s, err
+}
+
+// BackupAll takes a snapshot of every zone in the project.
+func (p *Provider) BackupAll(ctx context.Context) ([]*Snapshot, error) {
+	ctx, span := p.startSpan(ctx, "BackupAll", "", nil)
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	snapshots, err := p.backupAll(ctx)
+	endSpan(span, nil, err)
+	return snapshots, err
+}
+
+func (p *Provider) backupAll(ctx context.Context) ([]*Snapshot, error) {
+	zones, err := p.listZones(ctx)
+	if err != nil {
+		return nil, err
+	}
+	snapshots := []*Snapshot{}
+	for _, z := range zones {
+		s, err := p.backup(ctx, z.Name)
+		if err != nil {
+			return nil, err
+		}
+		snapshots = append(snapshots, s)
+	}
+	return snapshots, nil
+}
+
+func (p *Provider) backup(ctx context.Context, zone string) (*Snapshot, error) {
+	zone = cleanZ(zone)
+	if debug {
+		log.Printf("Backup zone=%s", zone)
+	}
+	d, err := p.client().DNSDomains.Details(ctx, zone)
+	if err != nil {
+		return nil, err
+	}
+	drs, err := p.client().DNSDomains.ListRecords(ctx, zone)
+	if err != nil {
+		return nil, err
+	}
+	s := &Snapshot{
+		Version: SnapshotVersion,
+		Zone:    zone,
+		TakenAt: time.Now().UTC(),
+		SOA: SnapshotSOA{
+			PrimaryNameServer: d.PrimaryNameServer,
+			ResponsiblePerson: d.ResponsiblePerson,
+			TTL:               d.TTL,
+			Refresh:           d.Refresh,
+			Retry:             d.Retry,
+			Expire:            d.Expire,
+			Minimum:           d.Minimum,
+		},
+		Records: make([]SnapshotRecord, 0, len(*drs)),
+	}
+	for _, dr := range *drs {
+		s.Records = append(s.Records, SnapshotRecord{ID: dr.RecordID, Name: dr.Host, Type: dr.Type, TTL: dr.TTL, Data: dr.Data})
+	}
+	return s, nil
+}
+
+// RestorePlan holds the changes needed to restore a zone to a snapshot.
+// Get one from PlanRestore, show it with String and apply it with
+// ApplyRestore.
+type RestorePlan struct {
+	Zone string
+	// SOA is the SOA to restore, nil if the SOA is unchanged.
+	SOA *SOA
+
+	currentSOA SOA
+	changes    changeSet
+	// records are the records of the zone the plan was made from.
+	records []impl.DNSDomainRecord
+}
+
+// Empty returns true if the zone already matches the snapshot.
+func (rp *RestorePlan) Empty() bool {
+	return rp.SOA == nil && rp.changes.empty()
+}
+
+// String previews the plan, one change per line.
+func (rp *RestorePlan) String() string {
+	sb := &strings.Builder{}
+	if rp.SOA != nil {
+		for _, change := range rp.currentSOA.diff(*rp.SOA) {
+			fmt.Fprintf(sb, "~ SOA %s\n", change)
+		}
+	}
+	sb.WriteString(rp.changes.String())
+	return sb.String()
+}
+
+// PlanRestore compares the live zone with the snapshot and returns the
+// changes needed to restore it. Nothing is changed.
+func (p *Provider) PlanRestore(ctx context.Context, s *Snapshot) (*RestorePlan, error) {
+	ctx, span := p.startSpan(ctx, "PlanRestore", s.Zone, nil)
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	rp, err := p.planRestore(ctx, s)
+	endSpan(span, nil, err)
+	return rp, err
+}
+
+func (p *Provider) planRestore(ctx context.Context, s *Snapshot) (*RestorePlan, error) {
+	zone := cleanZ(s.Zone)
+	if debug {
+		log.Printf("PlanRestore zone=%s", zone)
+	}
+	d, err := p.client().DNSDomains.Details(ctx, zone)
+	if err != nil {
+		return nil, err
+	}
+	existing, err := p.client().DNSDomains.ListRecords(ctx, zone)
+	if err != nil {
+		return nil, err
+	}
+	records := make([]libdns.Record, 0, len(s.Records))
+	for _, r := range s.Records {
+		records = append(records, libdns.RR{Name: r.Name, Type: r.Type, TTL: time.Duration(r.TTL) * time.Second, Data: r.Data})
+	}
+	rp := &RestorePlan{
+		Zone:       zone,
+		currentSOA: toSOA(d),
+		changes:    planZone(zone, *existing, records),
+		records:    *existing,
+	}
+	if soa := s.SOA.soa(); soa != rp.currentSOA {
+		rp.SOA = &soa
+	}
+	return rp, nil
+}
+
+// ApplyRestore applies a plan from PlanRestore. It fails with
+// ErrPlanOutdated, changing nothing, if the records of the zone have
+// changed since the plan was made. The records are restored first. If that
+// or restoring the SOA fails, the changes already made are reverted.
+func (p *Provider) ApplyRestore(ctx context.Context, rp *RestorePlan) error {
+	ctx, span := p.startSpan(ctx, "ApplyRestore", rp.Zone, nil)
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	err := p.applyRestore(ctx, rp)
+	endSpan(span, nil, err)
+	return err
+}
+
+func (p *Provider) applyRestore(ctx context.Context, rp *RestorePlan) error {
+	if debug {
+		log.Printf("ApplyRestore zone=%s", rp.Zone)
+	}
+	if err := p.checkOutdated(ctx, rp.Zone, rp.records, nil); err != nil {
+		return err
+	}
+	done, err := p.applyChanges(ctx, rp.Zone, rp.changes)
+	if err != nil {
+		return err
+	}
+	if rp.SOA == nil {
+		return nil
+	}
+	_, err = p.client().DNSDomains.Edit(ctx, rp.SOA.editParams(rp.Zone))
+	if err != nil {
+		if rerr := p.revertChanges(ctx, rp.Zone, done); rerr != nil {
+			return errors.Join(err, fmt.Errorf("failed to revert changes: %w", rerr))
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,216 @@
+// SPDX-FileCopyrightText: 2024 Peter Magnusson <me@kmpm.se>
+// SPDX-License-Identifier: MIT
+
+package glesys_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/libdns/glesys"
+	"github.com/libdns/glesys/glesystest"
+	"github.com/libdns/libdns"
+)
+
+func TestProvider_BackupAndRestore(t *testing.T) {
+	s := glesystest.NewServer()
+	defer s.Close()
+	s.AddZone("example.com", setRecordsInitial...)
+	p := s.Provider()
+	ctx := context.Background()
+	original := zoneState(s, "example.com")
+
+	snapshot, err := p.Backup(ctx, "example.com.")
+	if err != nil {
+		t.Fatalf("Backup() error = %v", err)
+	}
+	if snapshot.Version != glesys.SnapshotVersion || len(snapshot.Records) != len(setRecordsInitial) || snapshot.SOA.Refresh != 10800 {
+		t.Fatalf("Backup() = %+v", snapshot)
+	}
+	if snapshot.Records[0].ID != s.Records("example.com")[0].ID {
+		t.Errorf("Backup() did not keep the record IDs")
+	}
+	buf := &bytes.Buffer{}
+	if err := glesys.WriteSnapshot(buf, snapshot); err != nil {
+		t.Fatalf("WriteSnapshot() error = %v", err)
+	}
+
+	// damage the zone
+	if _, err := p.SetRecords(ctx, "example.com", setRecordsInput); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.AppendRecords(ctx, "example.com", []libdns.Record{libdns.TXT{Name: "new", TTL: time.Minute, Text: "x"}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.SetSOA(ctx, "example.com", glesys.SOA{Retry: time.Hour}); err != nil {
+		t.Fatal(err)
+	}
+
+	read, err := glesys.ReadSnapshot(buf)
+	if err != nil {
+		t.Fatalf("ReadSnapshot() error = %v", err)
+	}
+	plan, err := p.PlanRestore(ctx, read)
+	if err != nil {
+		t.Fatalf("PlanRestore() error = %v", err)
+	}
+	preview := plan.String()
+	for _, want := range []string{"~ SOA retry 1h0m0s -> 45m0s\n", "- new 60 TXT x", "- v6 3600 AAAA 2001:db8::1", "+ txt 3600 TXT b"} {
+		if !strings.Contains(preview, want) {
+			t.Errorf("Preview does not contain %q:\n%s", want, preview)
+		}
+	}
+	if plan.Empty() {
+		t.Errorf("Empty() = true for a damaged zone")
+	}
+
+	if err := p.ApplyRestore(ctx, plan); err != nil {
+		t.Fatalf("ApplyRestore() error = %v", err)
+	}
+	if got := zoneState(s, "example.com"); !reflect.DeepEqual(got, original) {
+		t.Errorf("Zone is %v after restore, want %v", got, original)
+	}
+	soa, _ := p.GetSOA(ctx, "example.com")
+	if soa.Retry != 45*time.Minute {
+		t.Errorf("SOA retry is %v after restore, want 45m", soa.Retry)
+	}
+	again, err := p.PlanRestore(ctx, read)
+	if err != nil || !again.Empty() {
+		t.Errorf("PlanRestore() after restore = %q, %v", again, err)
+	}
+}
+
+func TestProvider_ApplyRestoreRollback(t *testing.T) {
+	s := glesystest.NewServer()
+	defer s.Close()
+	s.AddZone("example.com", setRecordsInitial...)
+	p := s.Provider()
+	ctx := context.Background()
+	snapshot, err := p.Backup(ctx, "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.SetRecords(ctx, "example.com", setRecordsInput); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.SetSOA(ctx, "example.com", glesys.SOA{Retry: time.Hour}); err != nil {
+		t.Fatal(err)
+	}
+	damaged := zoneState(s, "example.com")
+	plan, err := p.PlanRestore(ctx, snapshot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Inject(glesystest.Fault{Endpoint: "domain/edit", Nth: 1, Kind: glesystest.FaultError})
+
+	err = p.ApplyRestore(ctx, plan)
+
+	if err == nil {
+		t.Fatalf("ApplyRestore() did not fail")
+	}
+	if got := zoneState(s, "example.com"); !reflect.DeepEqual(got, damaged) {
+		t.Errorf("Zone is %v after failed restore, want %v", got, damaged)
+	}
+}
+
+func TestProvider_ApplyRestoreOutdated(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(ctx context.Context, p *glesys.Provider) error
+	}{
+		{"added", func(ctx context.Context, p *glesys.Provider) error {
+			_, err := p.AppendRecords(ctx, "example.com", []libdns.Record{libdns.TXT{Name: "late", TTL: time.Hour, Text: "x"}})
+			return err
+		}},
+		{"changed", func(ctx context.Context, p *glesys.Provider) error {
+			_, err := p.SetRecords(ctx, "example.com", []libdns.Record{libdns.TXT{Name: "txt", TTL: time.Minute, Text: "a"}})
+			return err
+		}},
+		{"deleted", func(ctx context.Context, p *glesys.Provider) error {
+			_, err := p.DeleteRecords(ctx, "example.com", []libdns.Record{libdns.RR{Name: "v6", Type: "AAAA"}})
+			return err
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := glesystest.NewServer()
+			defer s.Close()
+			s.AddZone("example.com", setRecordsInitial...)
+			p := s.Provider()
+			ctx := context.Background()
+			snapshot, err := p.Backup(ctx, "example.com")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := p.SetRecords(ctx, "example.com", setRecordsInput); err != nil {
+				t.Fatal(err)
+			}
+			plan, err := p.PlanRestore(ctx, snapshot)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := tt.change(ctx, p); err != nil {
+				t.Fatal(err)
+			}
+			before := zoneState(s, "example.com")
+
+			err = p.ApplyRestore(ctx, plan)
+
+			if !errors.Is(err, glesys.ErrPlanOutdated) {
+				t.Errorf("ApplyRestore() error = %v, want ErrPlanOutdated", err)
+			}
+			if after := zoneState(s, "example.com"); !reflect.DeepEqual(after, before) {
+				t.Errorf("Zone changed to %v", after)
+			}
+		})
+	}
+}
+
+func TestProvider_BackupAll(t *testing.T) {
+	s := glesystest.NewServer()
+	defer s.Close()
+	s.AddZone("example.com", addr("www", "192.0.2.1"))
+	s.AddZone("example.org")
+
+	got, err := s.Provider().BackupAll(context.Background())
+
+	if err != nil {
+		t.Fatalf("BackupAll() error = %v", err)
+	}
+	if len(got) != 2 || got[0].Zone != "example.com" || len(got[0].Records) != 1 || got[1].Zone != "example.org" {
+		t.Errorf("BackupAll() = %+v", got)
+	}
+}
+
+func TestReadSnapshot(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		wantErr string
+	}{
+		{"ok", `{"version": 1, "zone": "example.com", "records": []}`, ""},
+		{"future_version", `{"version": 2, "zone": "example.com"}`, "unsupported version 2"},
+		{"no_version", `{"zone": "example.com"}`, "unsupported version 0"},
+		{"no_zone", `{"version": 1}`, "no zone"},
+		{"not_json", `zone example.com`, "failed to read snapshot"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := glesys.ReadSnapshot(strings.NewReader(tt.input))
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("ReadSnapshot() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ReadSnapshot() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
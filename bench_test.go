@@ -0,0 +1,109 @@
+// SPDX-FileCopyrightText: 2024 Peter Magnusson <me@kmpm.se>
+// SPDX-License-Identifier: MIT
+
+package glesys_test
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/libdns/glesys/glesystest"
+	"github.com/libdns/libdns"
+)
+
+// The benchmarks run the provider against glesystest, so they include
+// the HTTP round trips to an in-process server. Run them with
+//
+//	go test -run '^$' -bench Provider .
+
+var providerBenchSizes = []int{10, 100, 1000, 5000}
+
+// benchZone returns n records spread over n/2 names, an A and a TXT
+// record per name.
+func benchZone(n int) []libdns.Record {
+	records := make([]libdns.Record, 0, n)
+	for i := range n {
+		name := fmt.Sprintf("host%d", i/2)
+		if i%2 == 0 {
+			records = append(records, libdns.Address{Name: name, TTL: time.Hour, IP: netip.AddrFrom4([4]byte{192, 0, byte(i / 256), byte(i)})})
+		} else {
+			records = append(records, libdns.TXT{Name: name, TTL: time.Hour, Text: fmt.Sprintf("record %d", i)})
+		}
+	}
+	return records
+}
+
+// benchProvider runs fn for each zone size against a fresh server.
+func benchProvider(b *testing.B, fn func(b *testing.B, s *glesystest.Server, zone []libdns.Record)) {
+	for _, n := range providerBenchSizes {
+		b.Run(fmt.Sprintf("records_%d", n), func(b *testing.B) {
+			s := glesystest.NewServer()
+			defer s.Close()
+			zone := benchZone(n)
+			s.AddZone("example.com", zone...)
+			fn(b, s, zone)
+		})
+	}
+}
+
+func BenchmarkProvider_GetRecords(b *testing.B) {
+	benchProvider(b, func(b *testing.B, s *glesystest.Server, zone []libdns.Record) {
+		p := s.Provider()
+		for b.Loop() {
+			if _, err := p.GetRecords(context.Background(), "example.com"); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkProvider_AppendRecords(b *testing.B) {
+	benchProvider(b, func(b *testing.B, s *glesystest.Server, zone []libdns.Record) {
+		p := s.Provider()
+		input := []libdns.Record{libdns.TXT{Name: "_acme-challenge", TTL: time.Minute, Text: "token"}}
+		for b.Loop() {
+			if _, err := p.AppendRecords(context.Background(), "example.com", input); err != nil {
+				b.Fatal(err)
+			}
+			b.StopTimer()
+			s.AddZone("example.com", zone...)
+			b.StartTimer()
+		}
+	})
+}
+
+func BenchmarkProvider_SetRecords(b *testing.B) {
+	benchProvider(b, func(b *testing.B, s *glesystest.Server, zone []libdns.Record) {
+		p := s.Provider()
+		// alternate between two values so every call changes the zone
+		inputs := [][]libdns.Record{
+			{libdns.TXT{Name: "host0", TTL: time.Hour, Text: "a"}},
+			{libdns.TXT{Name: "host0", TTL: time.Hour, Text: "b"}},
+		}
+		i := 0
+		for b.Loop() {
+			if _, err := p.SetRecords(context.Background(), "example.com", inputs[i%2]); err != nil {
+				b.Fatal(err)
+			}
+			i++
+		}
+	})
+}
+
+func BenchmarkProvider_DeleteRecords(b *testing.B) {
+	benchProvider(b, func(b *testing.B, s *glesystest.Server, zone []libdns.Record) {
+		p := s.Provider()
+		input := zone[len(zone)/2:][:1]
+		for b.Loop() {
+			if _, err := p.DeleteRecords(context.Background(), "example.com", input); err != nil {
+				b.Fatal(err)
+			}
+			b.StopTimer()
+			s.AddZone("example.com", zone...)
+			b.StartTimer()
+		}
+	})
+}
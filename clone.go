@@ -0,0 +1,109 @@
+// SPDX-FileCopyrightText: 2024 Peter Magnusson <me@kmpm.se>
+// SPDX-License-Identifier: MIT
+
+package glesys
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/libdns/libdns"
+)
+
+// CloneOptions filter the records Clone copies. Names are relative to the
+// zone, like "www" or "@", and may be path.Match patterns like "_acme-*".
+// Types are matched ignoring case. Empty include lists include everything
+// and excludes win over includes.
+type CloneOptions struct {
+	IncludeTypes []string
+	ExcludeTypes []string
+	IncludeNames []string
+	ExcludeNames []string
+}
+
+// matchAny returns true if any of the patterns matches name.
+func matchAny(patterns []string, name string) bool {
+	return slices.ContainsFunc(patterns, func(pattern string) bool {
+		ok, _ := path.Match(pattern, name)
+		return ok
+	})
+}
+
+// includes returns true if the record passes the filters.
+func (o CloneOptions) includes(rr libdns.RR) bool {
+	typeIs := func(t string) bool { return strings.EqualFold(t, rr.Type) }
+	if len(o.IncludeTypes) > 0 && !slices.ContainsFunc(o.IncludeTypes, typeIs) {
+		return false
+	}
+	if slices.ContainsFunc(o.ExcludeTypes, typeIs) {
+		return false
+	}
+	if len(o.IncludeNames) > 0 && !matchAny(o.IncludeNames, rr.Name) {
+		return false
+	}
+	return !matchAny(o.ExcludeNames, rr.Name)
+}
+
+// rewriteTarget moves an absolute target inside the zone from to the
+// same name in the zone to. Other targets are returned unchanged.
+func rewriteTarget(target, from, to string) string {
+	from, to = cleanZ(from)+".", cleanZ(to)+"."
+	lower := strings.ToLower(target)
+	switch {
+	case lower == strings.ToLower(from):
+		return to
+	case strings.HasSuffix(lower, "."+strings.ToLower(from)):
+		return target[:len(target)-len(from)] + to
+	}
+	return target
+}
+
+// rewriteRecord rewrites the targets of CNAME, MX, NS and SRV records
+// pointing inside the zone from to point inside the zone to.
+func rewriteRecord(r libdns.Record, from, to string) libdns.Record {
+	switch r := r.(type) {
+	case libdns.CNAME:
+		r.Target = rewriteTarget(r.Target, from, to)
+		return r
+	case libdns.MX:
+		r.Target = rewriteTarget(r.Target, from, to)
+		return r
+	case libdns.NS:
+		r.Target = rewriteTarget(r.Target, from, to)
+		return r
+	case libdns.SRV:
+		r.Target = rewriteTarget(r.Target, from, to)
+		return r
+	}
+	return r
+}
+
+// Clone copies the records of srcZone, read from src, to dstZone through
+// dst, which may be a Provider for another GleSYS project. CNAME, MX, NS
+// and SRV targets inside srcZone are rewritten to dstZone, other data like
+// TXT records is copied as is. The records are written with a single
+// SetRecords call, so the copied RRsets replace those in dstZone and
+// cloning again changes nothing. It returns the records written.
+func Clone(ctx context.Context, src libdns.RecordGetter, srcZone string, dst libdns.RecordSetter, dstZone string, opts CloneOptions) ([]libdns.Record, error) {
+	records, err := src.GetRecords(ctx, srcZone)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", srcZone, err)
+	}
+	clones := []libdns.Record{}
+	for _, r := range records {
+		if opts.includes(r.RR()) {
+			clones = append(clones, rewriteRecord(r, srcZone, dstZone))
+		}
+	}
+	if len(clones) == 0 {
+		return clones, nil
+	}
+	written, err := dst.SetRecords(ctx, dstZone, clones)
+	if err != nil {
+		return nil, fmt.Errorf("failed to write %s: %w", dstZone, err)
+	}
+	return written, nil
+}
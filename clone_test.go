@@ -0,0 +1,115 @@
+// SPDX-FileCopyrightText: 2024 Peter Magnusson <me@kmpm.se>
+// SPDX-License-Identifier: MIT
+
+package glesys_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/libdns/glesys"
+	"github.com/libdns/glesys/glesystest"
+	"github.com/libdns/libdns"
+)
+
+var cloneSource = []libdns.Record{
+	addr("@", "192.0.2.1"),
+	addr("www", "192.0.2.1"),
+	libdns.CNAME{Name: "shop", TTL: time.Hour, Target: "www.Example.se."},
+	libdns.CNAME{Name: "cdn", TTL: time.Hour, Target: "cdn.example.net."},
+	libdns.CNAME{Name: "apex", TTL: time.Hour, Target: "example.se."},
+	libdns.CNAME{Name: "lookalike", TTL: time.Hour, Target: "www.notexample.se."},
+	libdns.MX{Name: "@", TTL: time.Hour, Preference: 10, Target: "mail.example.se."},
+	libdns.SRV{Service: "sip", Transport: "tcp", Name: "@", TTL: time.Hour, Priority: 10, Weight: 5, Port: 5060, Target: "sip.example.se."},
+	libdns.TXT{Name: "@", TTL: time.Hour, Text: "v=spf1 include:example.se -all"},
+	libdns.TXT{Name: "_acme-challenge", TTL: time.Minute, Text: "token"},
+}
+
+func TestClone(t *testing.T) {
+	tests := []struct {
+		name string
+		opts glesys.CloneOptions
+		want []libdns.Record
+	}{
+		{"all", glesys.CloneOptions{}, []libdns.Record{
+			addr("@", "192.0.2.1"),
+			addr("www", "192.0.2.1"),
+			libdns.CNAME{Name: "shop", TTL: time.Hour, Target: "www.example.no."},
+			libdns.CNAME{Name: "cdn", TTL: time.Hour, Target: "cdn.example.net."},
+			libdns.CNAME{Name: "apex", TTL: time.Hour, Target: "example.no."},
+			libdns.CNAME{Name: "lookalike", TTL: time.Hour, Target: "www.notexample.se."},
+			libdns.MX{Name: "@", TTL: time.Hour, Preference: 10, Target: "mail.example.no."},
+			libdns.SRV{Service: "sip", Transport: "tcp", Name: "@", TTL: time.Hour, Priority: 10, Weight: 5, Port: 5060, Target: "sip.example.no."},
+			libdns.TXT{Name: "@", TTL: time.Hour, Text: "v=spf1 include:example.se -all"},
+			libdns.TXT{Name: "_acme-challenge", TTL: time.Minute, Text: "token"},
+		}},
+		{"include_types", glesys.CloneOptions{IncludeTypes: []string{"a", "MX"}}, []libdns.Record{
+			addr("@", "192.0.2.1"),
+			addr("www", "192.0.2.1"),
+			libdns.MX{Name: "@", TTL: time.Hour, Preference: 10, Target: "mail.example.no."},
+		}},
+		{"exclude_names", glesys.CloneOptions{IncludeTypes: []string{"TXT"}, ExcludeNames: []string{"_acme-*"}}, []libdns.Record{
+			libdns.TXT{Name: "@", TTL: time.Hour, Text: "v=spf1 include:example.se -all"},
+		}},
+		{"include_names", glesys.CloneOptions{IncludeNames: []string{"www", "shop"}, ExcludeTypes: []string{"CNAME"}}, []libdns.Record{
+			addr("www", "192.0.2.1"),
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src := glesystest.NewServer()
+			defer src.Close()
+			src.AddZone("example.se", cloneSource...)
+			dst := glesystest.NewServer()
+			defer dst.Close()
+			dst.Project, dst.APIKey = "cl99999", "other-key"
+			dst.AddZone("example.no", addr("www", "192.0.2.9"), addr("old", "192.0.2.9"))
+			ctx := context.Background()
+
+			got, err := glesys.Clone(ctx, src.Provider(), "example.se.", dst.Provider(), "example.no.", tt.opts)
+
+			if err != nil {
+				t.Fatalf("Clone() error = %v", err)
+			}
+			assertRecords(t, "Clone", got, tt.want...)
+			written, err := dst.Provider().GetRecords(ctx, "example.no")
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, r := range tt.want {
+				if !slicesContainsRR(written, r) {
+					t.Errorf("Target zone is missing %v", r.RR())
+				}
+			}
+			if !slicesContainsRR(written, addr("old", "192.0.2.9")) {
+				t.Errorf("Clone() removed a record it did not copy")
+			}
+
+			again, err := glesys.Clone(ctx, src.Provider(), "example.se", dst.Provider(), "example.no", tt.opts)
+			if err != nil {
+				t.Fatalf("repeated Clone() error = %v", err)
+			}
+			assertRecords(t, "repeated Clone", again, tt.want...)
+		})
+	}
+}
+
+func TestCloneErrors(t *testing.T) {
+	s := glesystest.NewServer()
+	defer s.Close()
+	s.AddZone("example.se", cloneSource...)
+	p := s.Provider()
+	ctx := context.Background()
+
+	if _, err := glesys.Clone(ctx, p, "example.org", p, "example.no", glesys.CloneOptions{}); err == nil {
+		t.Errorf("Clone() from a missing zone did not fail")
+	}
+	if _, err := glesys.Clone(ctx, p, "example.se", p, "example.no", glesys.CloneOptions{}); err == nil {
+		t.Errorf("Clone() to a missing zone did not fail")
+	}
+	got, err := glesys.Clone(ctx, p, "example.se", p, "example.no", glesys.CloneOptions{IncludeTypes: []string{"AAAA"}})
+	if err != nil || len(got) != 0 {
+		t.Errorf("Clone() of nothing = %v, %v", got, err)
+	}
+}
@@ -0,0 +1,212 @@
+// SPDX-FileCopyrightText: 2024 Peter Magnusson <me@kmpm.se>
+// SPDX-License-Identifier: MIT
+
+// Command glesys-acme presents and cleans up the _acme-challenge TXT
+// records of ACME DNS-01 challenges at GleSYS.
+//
+// It follows the conventions of the lego exec provider,
+//
+//	EXEC_PATH=glesys-acme lego --dns exec ...
+//
+// which runs it as
+//
+//	glesys-acme present _acme-challenge.example.com. <value>
+//	glesys-acme cleanup _acme-challenge.example.com. <value>
+//
+// and of certbot manual hooks, which run it without arguments and pass
+// the domain and value in CERTBOT_DOMAIN and CERTBOT_VALIDATION:
+//
+//	certbot certonly --manual --preferred-challenges dns \
+//	    --manual-auth-hook glesys-acme --manual-cleanup-hook glesys-acme
+//
+// The zone is the longest zone of the project the name is in, unless
+// given with -zone. After presenting a record it waits until the
+// authoritative name servers of the zone serve it, up to -timeout.
+//
+// Every flag can also be set in the environment, the project and API
+// key in GLESYS_PROJECT and GLESYS_KEY and the other flags as
+// GLESYS_ACME_<FLAG>, e.g. GLESYS_ACME_TIMEOUT=5m.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/libdns/glesys"
+	"github.com/libdns/libdns"
+)
+
+// hook presents and cleans up challenge records.
+type hook struct {
+	p      *glesys.Provider
+	zone   string
+	ttl    time.Duration
+	wait   bool
+	stdout io.Writer
+}
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	os.Exit(run(ctx, os.Args[1:], os.Getenv, nil, os.Stdout, os.Stderr))
+}
+
+// run runs the hook and returns the exit code. exchanger sends the
+// queries that check if a presented record is served, nil sends them
+// with a default dns.Client.
+func run(ctx context.Context, args []string, getenv func(string) string, exchanger glesys.Exchanger, stdout, stderr io.Writer) int {
+	h := &hook{p: &glesys.Provider{DNSExchanger: exchanger}, stdout: stdout}
+	fs := flag.NewFlagSet("glesys-acme", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(stderr, "usage: glesys-acme [flags] present|cleanup FQDN VALUE\n       glesys-acme [flags] (certbot hook)\n\nflags:\n")
+		fs.PrintDefaults()
+	}
+	fs.StringVar(&h.p.Project, "project", getenv("GLESYS_PROJECT"), "GleSYS project")
+	fs.StringVar(&h.p.APIKey, "api-key", getenv("GLESYS_KEY"), "GleSYS API key")
+	fs.StringVar(&h.p.BaseURL, "base-url", getenv("GLESYS_ACME_BASE_URL"), "GleSYS API URL")
+	fs.StringVar(&h.zone, "zone", getenv("GLESYS_ACME_ZONE"), "zone of the records, found from the project if empty")
+	durations := []struct {
+		v     *time.Duration
+		name  string
+		value time.Duration
+		usage string
+	}{
+		{&h.ttl, "ttl", time.Minute, "TTL of the challenge records"},
+		{&h.p.PropagationTimeout, "timeout", 2 * time.Minute, "how long to wait for a presented record to be served, 0 to not wait"},
+		{&h.p.PollingInterval, "interval", 5 * time.Second, "how often to check if a presented record is served"},
+	}
+	for _, d := range durations {
+		value := d.value
+		if s := getenv("GLESYS_ACME_" + strings.ToUpper(d.name)); s != "" {
+			var err error
+			if value, err = time.ParseDuration(s); err != nil {
+				fmt.Fprintf(stderr, "glesys-acme: GLESYS_ACME_%s: %v\n", strings.ToUpper(d.name), err)
+				return 2
+			}
+		}
+		fs.DurationVar(d.v, d.name, value, d.usage)
+	}
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+	h.wait = h.p.PropagationTimeout > 0
+
+	args = fs.Args()
+	if len(args) == 0 && getenv("CERTBOT_DOMAIN") != "" {
+		// certbot passes what the auth hook printed, which is never
+		// empty, in CERTBOT_AUTH_OUTPUT to the cleanup hook only
+		action := "present"
+		if getenv("CERTBOT_AUTH_OUTPUT") != "" {
+			action = "cleanup"
+		}
+		args = []string{action, "_acme-challenge." + getenv("CERTBOT_DOMAIN"), getenv("CERTBOT_VALIDATION")}
+	}
+	if len(args) != 3 || (args[0] != "present" && args[0] != "cleanup") {
+		fs.Usage()
+		return 2
+	}
+	if h.p.Project == "" || h.p.APIKey == "" {
+		fmt.Fprintf(stderr, "glesys-acme: no credentials: use -project and -api-key or GLESYS_PROJECT and GLESYS_KEY\n")
+		return 2
+	}
+
+	fqdn, value := strings.TrimSuffix(args[1], ".")+".", args[2]
+	var err error
+	if args[0] == "present" {
+		err = h.present(ctx, fqdn, value)
+	} else {
+		err = h.cleanup(ctx, fqdn, value)
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "glesys-acme: %s %s: %v\n", args[0], fqdn, err)
+		return 1
+	}
+	return 0
+}
+
+// findZone returns the zone fqdn is in, without a trailing dot, and the
+// name of fqdn relative to it.
+func (h *hook) findZone(ctx context.Context, fqdn string) (string, string, error) {
+	inZone := func(zone string) bool {
+		zone = strings.ToLower(strings.TrimSuffix(zone, ".")) + "."
+		name := strings.ToLower(fqdn)
+		return name == zone || strings.HasSuffix(name, "."+zone)
+	}
+	zone := strings.TrimSuffix(h.zone, ".")
+	if zone != "" {
+		if !inZone(zone) {
+			return "", "", fmt.Errorf("not in zone %s", zone)
+		}
+	} else {
+		zones, err := h.p.ListZones(ctx)
+		if err != nil {
+			return "", "", err
+		}
+		for _, z := range zones {
+			if name := strings.TrimSuffix(z.Name, "."); inZone(name) && len(name) > len(zone) {
+				zone = name
+			}
+		}
+		if zone == "" {
+			return "", "", errors.New("not in any zone of the project")
+		}
+	}
+	return zone, libdns.RelativeName(strings.ToLower(fqdn), zone+"."), nil
+}
+
+// present adds the TXT record, unless it is already there, and waits
+// until the authoritative name servers of the zone serve it.
+func (h *hook) present(ctx context.Context, fqdn, value string) error {
+	zone, name, err := h.findZone(ctx, fqdn)
+	if err != nil {
+		return err
+	}
+	records, err := h.p.GetRecords(ctx, zone)
+	if err != nil {
+		return err
+	}
+	// challenges for a domain and its wildcard share the name, so the
+	// record is added next to any others
+	exists := slices.ContainsFunc(records, func(r libdns.Record) bool {
+		rr := r.RR()
+		return rr.Name == name && rr.Type == "TXT" && rr.Data == value
+	})
+	record := libdns.TXT{Name: name, TTL: h.ttl, Text: value}
+	if !exists {
+		_, err = h.p.AppendRecords(ctx, zone, []libdns.Record{record})
+		if err != nil {
+			return err
+		}
+	}
+	fmt.Fprintf(h.stdout, "presented %s TXT %q in %s\n", name, value, zone)
+	if !h.wait {
+		return nil
+	}
+	return h.p.WaitForRecords(ctx, zone, []libdns.Record{record})
+}
+
+// cleanup deletes the TXT record. It is not an error if it is gone.
+func (h *hook) cleanup(ctx context.Context, fqdn, value string) error {
+	zone, name, err := h.findZone(ctx, fqdn)
+	if err != nil {
+		return err
+	}
+	deleted, err := h.p.DeleteRecords(ctx, zone, []libdns.Record{libdns.TXT{Name: name, Text: value}})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(h.stdout, "cleaned up %d %s TXT records in %s\n", len(deleted), name, zone)
+	return nil
+}
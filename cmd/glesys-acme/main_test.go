@@ -0,0 +1,180 @@
+// SPDX-FileCopyrightText: 2024 Peter Magnusson <me@kmpm.se>
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/libdns/glesys/glesystest"
+	"github.com/libdns/libdns"
+	"github.com/miekg/dns"
+)
+
+// fakeExchanger answers TXT queries from the records of a glesystest
+// server, but only after the given number of queries, like a name server
+// catching up.
+type fakeExchanger struct {
+	s     *glesystest.Server
+	after int
+
+	mutex   sync.Mutex
+	queries int
+}
+
+func (e *fakeExchanger) ExchangeContext(ctx context.Context, m *dns.Msg, address string) (*dns.Msg, time.Duration, error) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.queries++
+	resp := new(dns.Msg)
+	resp.SetReply(m)
+	if e.queries <= e.after {
+		return resp, 0, nil
+	}
+	q := m.Question[0]
+	for _, zone := range []string{"example.com", "sub.example.com"} {
+		for _, rec := range e.s.Records(zone) {
+			if rec.Type == "TXT" && strings.EqualFold(libdns.AbsoluteName(rec.Host, zone+"."), q.Name) {
+				resp.Answer = append(resp.Answer, &dns.TXT{
+					Hdr: dns.RR_Header{Name: q.Name, Rrtype: dns.TypeTXT, Class: dns.ClassINET, Ttl: 60},
+					Txt: []string{rec.Data},
+				})
+			}
+		}
+	}
+	return resp, 0, nil
+}
+
+func newServer(t *testing.T) *glesystest.Server {
+	t.Helper()
+	s := glesystest.NewServer()
+	t.Cleanup(s.Close)
+	s.AddZone("example.com", libdns.TXT{Name: "@", TTL: time.Hour, Text: "v=spf1 -all"})
+	s.AddZone("sub.example.com")
+	return s
+}
+
+// runHook runs the hook against the server with the environment env.
+func runHook(t *testing.T, s *glesystest.Server, e *fakeExchanger, env map[string]string, args ...string) (string, string, int) {
+	t.Helper()
+	env["GLESYS_PROJECT"], env["GLESYS_KEY"], env["GLESYS_ACME_BASE_URL"] = s.Project, s.APIKey, s.URL
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	args = append([]string{"-interval", "1ms"}, args...)
+	code := run(context.Background(), args, func(name string) string { return env[name] }, e, stdout, stderr)
+	return stdout.String(), stderr.String(), code
+}
+
+func challenges(s *glesystest.Server, zone, host string) []string {
+	values := []string{}
+	for _, rec := range s.Records(zone) {
+		if rec.Host == host && rec.Type == "TXT" {
+			values = append(values, rec.Data)
+		}
+	}
+	slices.Sort(values)
+	return values
+}
+
+func TestLego(t *testing.T) {
+	tests := []struct {
+		name     string
+		fqdn     string
+		zone     string
+		host     string
+		zoneFlag string
+	}{
+		{"apex", "_acme-challenge.example.com.", "example.com", "_acme-challenge", ""},
+		{"subdomain", "_acme-challenge.www.example.com.", "example.com", "_acme-challenge.www", ""},
+		{"longest_zone", "_acme-challenge.sub.example.com", "sub.example.com", "_acme-challenge", ""},
+		{"zone_flag", "_acme-challenge.sub.example.com.", "example.com", "_acme-challenge.sub", "example.com"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newServer(t)
+			e := &fakeExchanger{s: s, after: 2}
+			env := map[string]string{"GLESYS_ACME_ZONE": tt.zoneFlag}
+
+			// a domain and its wildcard are validated with two values
+			for _, value := range []string{"token-1", "token-2", "token-1"} {
+				if _, stderr, code := runHook(t, s, e, env, "present", tt.fqdn, value); code != 0 {
+					t.Fatalf("present exited with %d: %s", code, stderr)
+				}
+			}
+			if got := challenges(s, tt.zone, tt.host); !slices.Equal(got, []string{"token-1", "token-2"}) {
+				t.Errorf("after present %s TXT = %v", tt.host, got)
+			}
+			if e.queries < 3 {
+				t.Errorf("present did not wait for the record, %d queries", e.queries)
+			}
+
+			for _, value := range []string{"token-1", "token-1"} {
+				if _, stderr, code := runHook(t, s, e, env, "cleanup", tt.fqdn, value); code != 0 {
+					t.Fatalf("cleanup exited with %d: %s", code, stderr)
+				}
+			}
+			if got := challenges(s, tt.zone, tt.host); !slices.Equal(got, []string{"token-2"}) {
+				t.Errorf("after cleanup %s TXT = %v", tt.host, got)
+			}
+			if got := challenges(s, "example.com", "@"); !slices.Equal(got, []string{"v=spf1 -all"}) {
+				t.Errorf("other records changed to %v", got)
+			}
+		})
+	}
+}
+
+func TestCertbot(t *testing.T) {
+	s := newServer(t)
+	e := &fakeExchanger{s: s}
+	env := map[string]string{"CERTBOT_DOMAIN": "www.example.com", "CERTBOT_VALIDATION": "token"}
+
+	out, stderr, code := runHook(t, s, e, env)
+	if code != 0 {
+		t.Fatalf("auth hook exited with %d: %s", code, stderr)
+	}
+	if got := challenges(s, "example.com", "_acme-challenge.www"); !slices.Equal(got, []string{"token"}) {
+		t.Errorf("after auth hook TXT = %v", got)
+	}
+
+	env["CERTBOT_AUTH_OUTPUT"] = out
+	if _, stderr, code := runHook(t, s, e, env); code != 0 {
+		t.Fatalf("cleanup hook exited with %d: %s", code, stderr)
+	}
+	if got := challenges(s, "example.com", "_acme-challenge.www"); len(got) != 0 {
+		t.Errorf("after cleanup hook TXT = %v", got)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+		args []string
+		code int
+		want string
+	}{
+		{"usage", map[string]string{}, []string{"present", "_acme-challenge.example.com."}, 2, "usage"},
+		{"unknown_zone", map[string]string{}, []string{"present", "_acme-challenge.example.net.", "x"}, 1, "not in any zone"},
+		{"outside_zone", map[string]string{"GLESYS_ACME_ZONE": "sub.example.com"}, []string{"present", "_acme-challenge.example.com.", "x"}, 1, "not in zone"},
+		{"timeout", map[string]string{"GLESYS_ACME_TIMEOUT": "20ms"}, []string{"present", "_acme-challenge.example.com.", "x"}, 1, "records not served"},
+		{"bad_env", map[string]string{"GLESYS_ACME_TTL": "soon"}, []string{"present", "_acme-challenge.example.com.", "x"}, 2, "GLESYS_ACME_TTL"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newServer(t)
+			// the record is never served
+			e := &fakeExchanger{s: s, after: 1 << 30}
+
+			_, stderr, code := runHook(t, s, e, tt.env, tt.args...)
+
+			if code != tt.code || !strings.Contains(stderr, tt.want) {
+				t.Errorf("exit code = %d, stderr = %q, want %d and %q", code, stderr, tt.code, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,340 @@
+// SPDX-FileCopyrightText: 2024 Peter Magnusson <me@kmpm.se>
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/libdns/glesys"
+	"github.com/libdns/libdns"
+)
+
+func setupZones(fs *flag.FlagSet) runFunc {
+	return func(ctx context.Context, e *env, args []string) error {
+		p, err := e.provider()
+		if err != nil {
+			return err
+		}
+		zones, err := p.ListZones(ctx)
+		if err != nil {
+			return err
+		}
+		names := make([]string, 0, len(zones))
+		for _, z := range zones {
+			names = append(names, strings.TrimSuffix(z.Name, "."))
+		}
+		if e.output == "json" {
+			return writeJSON(e.stdout, names)
+		}
+		tw := tabwriter.NewWriter(e.stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "NAME")
+		for _, name := range names {
+			fmt.Fprintln(tw, name)
+		}
+		return tw.Flush()
+	}
+}
+
+func setupList(fs *flag.FlagSet) runFunc {
+	name := fs.String("name", "", "only list records with this name, like www or @")
+	typ := fs.String("type", "", "only list records of this type")
+	return func(ctx context.Context, e *env, args []string) error {
+		p, err := e.provider()
+		if err != nil {
+			return err
+		}
+		zone := strings.TrimSuffix(args[0], ".")
+		records, err := p.GetRecords(ctx, zone)
+		if err != nil {
+			return err
+		}
+		matching := []libdns.Record{}
+		for _, r := range records {
+			rr := r.RR()
+			if (*name == "" || rr.Name == *name) && (*typ == "" || strings.EqualFold(rr.Type, *typ)) {
+				matching = append(matching, r)
+			}
+		}
+		return writeRecords(e.stdout, e.output, zone, matching)
+	}
+}
+
+// parseRecord parses a record given as arguments.
+func parseRecord(name, typ, data string, ttl time.Duration) (libdns.Record, error) {
+	r, err := libdns.RR{Name: name, Type: strings.ToUpper(typ), Data: data, TTL: ttl}.Parse()
+	if err != nil {
+		return nil, fmt.Errorf("invalid record %s %s %q: %w", name, typ, data, err)
+	}
+	return r, nil
+}
+
+func setupAdd(fs *flag.FlagSet) runFunc {
+	ttl := fs.Duration("ttl", time.Hour, "TTL of the record")
+	return func(ctx context.Context, e *env, args []string) error {
+		zone := strings.TrimSuffix(args[0], ".")
+		r, err := parseRecord(args[1], args[2], args[3], *ttl)
+		if err != nil {
+			return err
+		}
+		c := newChanges(zone, e.dryRun)
+		if e.dryRun {
+			c.Added = append(c.Added, toRecord(r))
+			return c.write(e.stdout, e.output)
+		}
+		p, err := e.provider()
+		if err != nil {
+			return err
+		}
+		added, err := p.AppendRecords(ctx, zone, []libdns.Record{r})
+		if err != nil {
+			return err
+		}
+		for _, r := range added {
+			c.Added = append(c.Added, toRecord(r))
+		}
+		return c.write(e.stdout, e.output)
+	}
+}
+
+func setupSet(fs *flag.FlagSet) runFunc {
+	ttl := fs.Duration("ttl", time.Hour, "TTL of the records")
+	copyProtected := fs.Bool("copy-protected", false, "allow replacing the apex NS or SOA records")
+	return func(ctx context.Context, e *env, args []string) error {
+		zone := strings.TrimSuffix(args[0], ".")
+		if typ := strings.ToUpper(args[2]); !*copyProtected && (typ == "SOA" || typ == "NS" && args[1] == "@") {
+			return fmt.Errorf("refusing to replace the %s records at the apex of %s without -copy-protected", typ, zone)
+		}
+		src := &source{zone: zone}
+		for _, data := range args[3:] {
+			r, err := parseRecord(args[1], args[2], data, *ttl)
+			if err != nil {
+				return err
+			}
+			src.records = append(src.records, r)
+		}
+		p, err := e.provider()
+		if err != nil {
+			return err
+		}
+		// a merge sync replaces the one RRset of src and keeps the rest of
+		// the zone, and unlike SetRecords it can be a dry run
+		report, err := p.Sync(ctx, src, zone, zone, glesys.SyncOptions{Mode: glesys.SyncMerge, DryRun: e.dryRun, CopyProtected: *copyProtected})
+		if err != nil {
+			return err
+		}
+		return fromReport(report).write(e.stdout, e.output)
+	}
+}
+
+func setupDelete(fs *flag.FlagSet) runFunc {
+	return func(ctx context.Context, e *env, args []string) error {
+		p, err := e.provider()
+		if err != nil {
+			return err
+		}
+		zone := strings.TrimSuffix(args[0], ".")
+		want := libdns.RR{Name: args[1]}
+		if len(args) > 2 {
+			want.Type = args[2]
+		}
+		if len(args) > 3 {
+			want.Data = args[3]
+		}
+		records, err := p.GetRecords(ctx, zone)
+		if err != nil {
+			return err
+		}
+		matching := []libdns.Record{}
+		for _, r := range records {
+			rr := r.RR()
+			if rr.Name == want.Name && (want.Type == "" || strings.EqualFold(rr.Type, want.Type)) && (want.Data == "" || rr.Data == want.Data) {
+				matching = append(matching, r)
+			}
+		}
+		c := newChanges(zone, e.dryRun)
+		c.Unchanged = len(records) - len(matching)
+		if !e.dryRun && len(matching) > 0 {
+			if matching, err = p.DeleteRecords(ctx, zone, matching); err != nil {
+				return err
+			}
+		}
+		for _, r := range matching {
+			c.Deleted = append(c.Deleted, toRecord(r))
+		}
+		return c.write(e.stdout, e.output)
+	}
+}
+
+func setupExport(fs *flag.FlagSet) runFunc {
+	return func(ctx context.Context, e *env, args []string) error {
+		p, err := e.provider()
+		if err != nil {
+			return err
+		}
+		zone := strings.TrimSuffix(args[0], ".")
+		records, err := p.GetRecords(ctx, zone)
+		if err != nil {
+			return err
+		}
+		output := e.output
+		if output == "table" && !isSet(fs, "o") {
+			output = "zone"
+		}
+		return writeRecords(e.stdout, output, zone, records)
+	}
+}
+
+func setupImport(fs *flag.FlagSet) runFunc {
+	prune := fs.Bool("prune", false, "delete the records not in the file, except the apex NS records")
+	maxDeletions := fs.Int("max-deletions", 0, "refuse to delete more records than this with -prune")
+	copyProtected := fs.Bool("copy-protected", false, "also import the apex NS and SOA records of the file")
+	return func(ctx context.Context, e *env, args []string) error {
+		zone := strings.TrimSuffix(args[0], ".")
+		src, srcZone, err := readFile(args[1], zone)
+		if err != nil {
+			return err
+		}
+		p, err := e.provider()
+		if err != nil {
+			return err
+		}
+		if *maxDeletions > 0 {
+			p.MaxDeletions = *maxDeletions
+		}
+		opts := glesys.SyncOptions{Mode: glesys.SyncMerge, DryRun: e.dryRun, CopyProtected: *copyProtected}
+		if *prune {
+			opts.Mode = glesys.SyncAuthoritative
+		}
+		report, err := p.Sync(ctx, src, srcZone, zone, opts)
+		if err != nil {
+			return err
+		}
+		return fromReport(report).write(e.stdout, e.output)
+	}
+}
+
+func setupDiff(fs *flag.FlagSet) runFunc {
+	return func(ctx context.Context, e *env, args []string) error {
+		type side struct {
+			getter libdns.RecordGetter
+			zone   string
+		}
+		sides := [2]side{}
+		for i, arg := range args {
+			// an existing file is read, anything else is a zone at GleSYS
+			if _, err := os.Stat(arg); err == nil {
+				getter, zone, err := readFile(arg, "")
+				if err != nil {
+					return err
+				}
+				sides[i] = side{getter, zone}
+				continue
+			}
+			p, err := e.provider()
+			if err != nil {
+				return err
+			}
+			sides[i] = side{p, strings.TrimSuffix(arg, ".")}
+		}
+		d, err := glesys.DiffZones(ctx, sides[0].getter, sides[0].zone, sides[1].getter, sides[1].zone)
+		if err != nil {
+			return err
+		}
+		d.From, d.To = args[0], args[1]
+		if e.output == "json" {
+			return writeJSON(e.stdout, d)
+		}
+		_, err = fmt.Fprint(e.stdout, d)
+		return err
+	}
+}
+
+func setupPlan(fs *flag.FlagSet) runFunc {
+	return func(ctx context.Context, e *env, args []string) error {
+		p, err := e.provider()
+		if err != nil {
+			return err
+		}
+		plan, err := planConfig(ctx, p, args[0])
+		if err != nil {
+			return err
+		}
+		if e.output == "json" {
+			return writeJSON(e.stdout, plan.Diff)
+		}
+		return writePlan(e.stdout, plan)
+	}
+}
+
+func setupApply(fs *flag.FlagSet) runFunc {
+	yes := fs.Bool("yes", false, "apply without asking for confirmation")
+	maxDeletions := fs.Int("max-deletions", 0, "refuse to delete more records than this")
+	return func(ctx context.Context, e *env, args []string) error {
+		p, err := e.provider()
+		if err != nil {
+			return err
+		}
+		// the limit is checked by the planning, before anything is asked
+		if *maxDeletions > 0 {
+			p.MaxDeletions = *maxDeletions
+		}
+		plan, err := planConfig(ctx, p, args[0])
+		if err != nil {
+			return err
+		}
+		if err := writePlan(e.stdout, plan); err != nil || plan.Empty() || e.dryRun {
+			return err
+		}
+		if !*yes {
+			fmt.Fprintf(e.stdout, "Apply these changes to %s? [y/N] ", plan.Zone)
+			answer, _ := bufio.NewReader(e.stdin).ReadString('\n')
+			if a := strings.ToLower(strings.TrimSpace(answer)); a != "y" && a != "yes" {
+				return errors.New("not applied")
+			}
+		}
+		report, err := p.ApplyZonePlan(ctx, plan)
+		if err != nil {
+			return err
+		}
+		return fromReport(report).write(e.stdout, e.output)
+	}
+}
+
+// planConfig loads the zone config in the file name and plans it against
+// the zone at GleSYS.
+func planConfig(ctx context.Context, p *glesys.Provider, name string) (*glesys.ZonePlan, error) {
+	cfg, err := glesys.LoadZoneConfig(name)
+	if err != nil {
+		return nil, err
+	}
+	return p.PlanZoneConfig(ctx, cfg)
+}
+
+// writePlan writes the diff of the plan, or that there are no changes.
+func writePlan(w io.Writer, plan *glesys.ZonePlan) error {
+	if plan.Empty() {
+		_, err := fmt.Fprintf(w, "%s: no changes\n", plan.Zone)
+		return err
+	}
+	_, err := fmt.Fprint(w, plan)
+	return err
+}
+
+// isSet returns true if the flag was given on the command line.
+func isSet(fs *flag.FlagSet, name string) bool {
+	set := false
+	fs.Visit(func(f *flag.Flag) {
+		set = set || f.Name == name
+	})
+	return set
+}
@@ -0,0 +1,226 @@
+// SPDX-FileCopyrightText: 2024 Peter Magnusson <me@kmpm.se>
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/libdns/glesys"
+	"github.com/libdns/glesys/internal/zonefile"
+	"github.com/libdns/libdns"
+	"github.com/miekg/dns"
+)
+
+// record is a record in JSON output. The TTL is in seconds.
+type record struct {
+	Name string `json:"name"`
+	TTL  int    `json:"ttl"`
+	Type string `json:"type"`
+	Data string `json:"data"`
+}
+
+func toRecord(r libdns.Record) record {
+	rr := r.RR()
+	return record{Name: rr.Name, TTL: int(rr.TTL / time.Second), Type: rr.Type, Data: rr.Data}
+}
+
+func (r record) String() string {
+	return fmt.Sprintf("%s %d %s %s", r.Name, r.TTL, r.Type, r.Data)
+}
+
+func writeJSON(w io.Writer, v any) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// writeRecords writes records in the output format.
+func writeRecords(w io.Writer, output, zone string, records []libdns.Record) error {
+	switch output {
+	case "json":
+		out := make([]record, 0, len(records))
+		for _, r := range records {
+			out = append(out, toRecord(r))
+		}
+		return writeJSON(w, out)
+	case "zone":
+		return writeZoneFile(w, zone, records)
+	}
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tTTL\tTYPE\tDATA")
+	for _, r := range records {
+		rec := toRecord(r)
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%s\n", rec.Name, rec.TTL, rec.Type, rec.Data)
+	}
+	return tw.Flush()
+}
+
+// writeZoneFile writes records as an RFC 1035 zone file with names
+// relative to $ORIGIN.
+func writeZoneFile(w io.Writer, zone string, records []libdns.Record) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "$ORIGIN %s.\n", strings.TrimSuffix(zone, "."))
+	for _, r := range records {
+		rr := r.RR()
+		data := rr.Data
+		if strings.EqualFold(rr.Type, "TXT") {
+			data = quoteTXT(data)
+		}
+		fmt.Fprintf(bw, "%s\t%d\tIN\t%s\t%s\n", rr.Name, int(rr.TTL/time.Second), rr.Type, data)
+	}
+	return bw.Flush()
+}
+
+// quoteTXT quotes the text of a TXT record as zone file character
+// strings of at most 255 bytes each.
+func quoteTXT(text string) string {
+	quoted := []string{}
+	for {
+		chunk := text
+		if len(chunk) > 255 {
+			chunk = chunk[:255]
+		}
+		text = text[len(chunk):]
+		chunk = strings.ReplaceAll(chunk, `\`, `\\`)
+		quoted = append(quoted, `"`+strings.ReplaceAll(chunk, `"`, `\"`)+`"`)
+		if text == "" {
+			return strings.Join(quoted, " ")
+		}
+	}
+}
+
+// source is records read from a file, usable wherever a
+// libdns.RecordGetter is.
+type source struct {
+	zone    string
+	records []libdns.Record
+}
+
+func (s *source) GetRecords(ctx context.Context, zone string) ([]libdns.Record, error) {
+	if !strings.EqualFold(strings.TrimSuffix(zone, "."), s.zone) {
+		return nil, fmt.Errorf("file is of %s, not %s", s.zone, zone)
+	}
+	return s.records, nil
+}
+
+// readFile reads a JSON snapshot written by Provider.Backup or a zone
+// file. The zone is that of the snapshot, the $ORIGIN of the zone file or
+// else zone. SOA records in zone files are skipped, GleSYS manages those.
+func readFile(name, zone string) (libdns.RecordGetter, string, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, "", err
+	}
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+		s, err := glesys.ReadSnapshot(bytes.NewReader(data))
+		if err != nil {
+			return nil, "", fmt.Errorf("%s: %w", name, err)
+		}
+		return s, strings.TrimSuffix(s.Zone, "."), nil
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if fields := strings.Fields(line); len(fields) >= 2 && strings.EqualFold(fields[0], "$ORIGIN") {
+			zone = fields[1]
+			break
+		}
+	}
+	zone = strings.TrimSuffix(zone, ".")
+	if zone == "" {
+		return nil, "", fmt.Errorf("%s: no $ORIGIN in zone file", name)
+	}
+	src := &source{zone: zone, records: []libdns.Record{}}
+	zp := dns.NewZoneParser(bytes.NewReader(data), zone+".", name)
+	for rr, ok := zp.Next(); ok; rr, ok = zp.Next() {
+		if _, soa := rr.(*dns.SOA); soa {
+			continue
+		}
+		hdr := rr.Header()
+		r := libdns.RR{
+			Name: libdns.RelativeName(hdr.Name, zone+"."),
+			TTL:  time.Duration(hdr.Ttl) * time.Second,
+			Type: dns.TypeToString[hdr.Rrtype],
+			Data: strings.TrimPrefix(rr.String(), hdr.String()),
+		}
+		if txt, ok := rr.(*dns.TXT); ok {
+			r.Data = zonefile.UnescapeTXT(strings.Join(txt.Txt, ""))
+		}
+		parsed, err := r.Parse()
+		if err != nil {
+			return nil, "", fmt.Errorf("%s: %w", name, err)
+		}
+		src.records = append(src.records, parsed)
+	}
+	if err := zp.Err(); err != nil {
+		return nil, "", err
+	}
+	return src, zone, nil
+}
+
+// changes are the changes a mutating command made, or would make with
+// -dry-run.
+type changes struct {
+	Zone      string   `json:"zone"`
+	DryRun    bool     `json:"dry_run"`
+	Added     []record `json:"added"`
+	Updated   []update `json:"updated"`
+	Deleted   []record `json:"deleted"`
+	Unchanged int      `json:"unchanged"`
+}
+
+type update struct {
+	From record `json:"from"`
+	To   record `json:"to"`
+}
+
+func newChanges(zone string, dryRun bool) *changes {
+	return &changes{Zone: zone, DryRun: dryRun, Added: []record{}, Updated: []update{}, Deleted: []record{}}
+}
+
+func fromReport(r *glesys.SyncReport) *changes {
+	c := newChanges(r.Zone, r.DryRun)
+	for _, a := range r.Added {
+		c.Added = append(c.Added, toRecord(a))
+	}
+	for _, u := range r.Updated {
+		c.Updated = append(c.Updated, update{From: toRecord(u.From), To: toRecord(u.To)})
+	}
+	for _, d := range r.Deleted {
+		c.Deleted = append(c.Deleted, toRecord(d))
+	}
+	c.Unchanged = r.Unchanged
+	return c
+}
+
+// write writes the changes as JSON or one per line, prefixed with +, ~
+// or -, followed by a summary.
+func (c *changes) write(w io.Writer, output string) error {
+	if output == "json" {
+		return writeJSON(w, c)
+	}
+	for _, r := range c.Added {
+		fmt.Fprintf(w, "+ %s\n", r)
+	}
+	for _, u := range c.Updated {
+		fmt.Fprintf(w, "~ %s -> %s\n", u.From, u.To)
+	}
+	for _, r := range c.Deleted {
+		fmt.Fprintf(w, "- %s\n", r)
+	}
+	dry := ""
+	if c.DryRun {
+		dry = " (dry run)"
+	}
+	_, err := fmt.Fprintf(w, "%s%s: %d added, %d updated, %d deleted, %d unchanged\n",
+		c.Zone, dry, len(c.Added), len(c.Updated), len(c.Deleted), c.Unchanged)
+	return err
+}
@@ -0,0 +1,187 @@
+// SPDX-FileCopyrightText: 2024 Peter Magnusson <me@kmpm.se>
+// SPDX-License-Identifier: MIT
+
+// Command glesys-dns manages GleSYS DNS zones from a terminal.
+//
+// Usage:
+//
+//	glesys-dns <command> [flags] [arguments]
+//
+// The commands are zones, list, add, set, delete, export, import, diff,
+// plan and apply.
+// Run glesys-dns <command> -h for the flags and arguments of a command.
+// Flags go before the arguments.
+//
+// Credentials are taken from the -project and -api-key flags, then the
+// GLESYS_PROJECT and GLESYS_KEY environment variables and last from the
+// JSON config file given by -config, by default glesys-dns/config.json in
+// the user config directory:
+//
+//	{"project": "cl12345", "api_key": "...", "max_deletions": 20}
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+
+	"github.com/libdns/glesys"
+)
+
+// runFunc runs a command with the arguments left after the flags.
+type runFunc func(ctx context.Context, e *env, args []string) error
+
+// command is a subcommand of glesys-dns. setup adds the flags of the
+// command and returns the function that runs it.
+type command struct {
+	usage    string
+	help     string
+	min, max int // number of arguments, max -1 for any
+	setup    func(fs *flag.FlagSet) runFunc
+}
+
+var commands = map[string]command{
+	"zones":  {"zones", "list the zones of the project", 0, 0, setupZones},
+	"list":   {"list [-name NAME] [-type TYPE] ZONE", "list the records of a zone", 1, 1, setupList},
+	"add":    {"add [-ttl TTL] ZONE NAME TYPE DATA", "add a record", 4, 4, setupAdd},
+	"set":    {"set [-ttl TTL] ZONE NAME TYPE DATA...", "replace the records of an RRset", 4, -1, setupSet},
+	"delete": {"delete ZONE NAME [TYPE [DATA]]", "delete matching records", 2, 4, setupDelete},
+	"export": {"export ZONE", "write the records of a zone, as a zone file by default", 1, 1, setupExport},
+	"import": {"import [-prune] ZONE FILE", "set the records of a zone from a zone file or JSON snapshot", 2, 2, setupImport},
+	"diff":   {"diff FROM TO", "compare zones, zone files or JSON snapshots", 2, 2, setupDiff},
+	"plan":   {"plan FILE", "show the changes that make a zone match a YAML or JSON zone config", 1, 1, setupPlan},
+	"apply":  {"apply [-yes] FILE", "make a zone match a YAML or JSON zone config, after confirmation", 1, 1, setupApply},
+}
+
+// env is what commands run with: the input and output, the common flags
+// and the provider.
+type env struct {
+	stdin  io.Reader
+	stdout io.Writer
+	output string
+	dryRun bool
+
+	p      *glesys.Provider
+	config string
+}
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	os.Exit(run(ctx, os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run runs the command in args and returns the exit code.
+func run(ctx context.Context, args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) == 0 || slices.Contains([]string{"-h", "-help", "--help", "help"}, args[0]) {
+		usage(stderr)
+		return 2
+	}
+	cmd, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprintf(stderr, "glesys-dns: unknown command %q\n", args[0])
+		usage(stderr)
+		return 2
+	}
+
+	e := &env{stdin: stdin, stdout: stdout, p: &glesys.Provider{}}
+	fs := flag.NewFlagSet(args[0], flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(stderr, "usage: glesys-dns %s\n\n%s\n\nflags:\n", cmd.usage, cmd.help)
+		fs.PrintDefaults()
+	}
+	fs.StringVar(&e.config, "config", "", "JSON config file with credentials")
+	fs.StringVar(&e.p.Project, "project", "", "GleSYS project, or GLESYS_PROJECT")
+	fs.StringVar(&e.p.APIKey, "api-key", "", "GleSYS API key, or GLESYS_KEY")
+	fs.StringVar(&e.p.BaseURL, "base-url", "", "GleSYS API URL")
+	fs.StringVar(&e.output, "o", "table", "output format: table, json or zone")
+	fs.BoolVar(&e.dryRun, "dry-run", false, "show the changes without making them")
+	fn := cmd.setup(fs)
+	if err := fs.Parse(args[1:]); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+	if n := fs.NArg(); n < cmd.min || (cmd.max >= 0 && n > cmd.max) {
+		fmt.Fprintf(stderr, "glesys-dns: wrong number of arguments\n")
+		fs.Usage()
+		return 2
+	}
+	if !slices.Contains([]string{"table", "json", "zone"}, e.output) {
+		fmt.Fprintf(stderr, "glesys-dns: unknown output format %q\n", e.output)
+		return 2
+	}
+
+	if err := fn(ctx, e, fs.Args()); err != nil {
+		fmt.Fprintf(stderr, "glesys-dns: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintf(w, "usage: glesys-dns <command> [flags] [arguments]\n\ncommands:\n")
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		fmt.Fprintf(w, "  %-8s %s\n", name, commands[name].help)
+	}
+}
+
+// provider returns the provider after filling in the credentials not
+// given as flags from the environment and then the config file. The
+// other settings, like max_deletions, always come from the config file.
+func (e *env) provider() (*glesys.Provider, error) {
+	p := e.p
+	if p.Project == "" {
+		p.Project = os.Getenv("GLESYS_PROJECT")
+	}
+	if p.APIKey == "" {
+		p.APIKey = os.Getenv("GLESYS_KEY")
+	}
+	config := e.config
+	if config == "" {
+		// the default config file is optional, but read when it exists
+		// for the settings other than the credentials
+		if dir, err := os.UserConfigDir(); err == nil {
+			name := filepath.Join(dir, "glesys-dns", "config.json")
+			if _, err := os.Stat(name); err == nil {
+				config = name
+			}
+		}
+	}
+	if config != "" {
+		data, err := os.ReadFile(config)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read config: %w", err)
+		}
+		file := &glesys.Provider{}
+		if err := json.Unmarshal(data, file); err != nil {
+			return nil, fmt.Errorf("failed to read config %s: %w", config, err)
+		}
+		p.Project = cmp.Or(p.Project, file.Project)
+		p.APIKey = cmp.Or(p.APIKey, file.APIKey)
+		p.BaseURL = cmp.Or(p.BaseURL, file.BaseURL)
+		p.MaxDeletions = file.MaxDeletions
+	}
+	if p.Project == "" || p.APIKey == "" {
+		if config == "" {
+			return nil, errors.New("no credentials: use -project and -api-key, GLESYS_PROJECT and GLESYS_KEY or a config file")
+		}
+		return nil, fmt.Errorf("no credentials in %s", config)
+	}
+	return p, nil
+}
@@ -0,0 +1,427 @@
+// SPDX-FileCopyrightText: 2024 Peter Magnusson <me@kmpm.se>
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/libdns/glesys"
+	"github.com/libdns/glesys/glesystest"
+	"github.com/libdns/libdns"
+)
+
+func addr(name, ip string) libdns.Address {
+	return libdns.Address{Name: name, TTL: time.Hour, IP: netip.MustParseAddr(ip)}
+}
+
+var testRecords = []libdns.Record{
+	libdns.NS{Name: "@", TTL: time.Hour, Target: "ns1.namesystem.se."},
+	addr("www", "192.0.2.1"),
+	addr("www", "192.0.2.2"),
+	libdns.CNAME{Name: "shop", TTL: time.Hour, Target: "www.example.com."},
+	libdns.MX{Name: "@", TTL: time.Hour, Preference: 10, Target: "mail.example.com."},
+	libdns.TXT{Name: "@", TTL: time.Hour, Text: `v=spf1 include:"example.net" -all`},
+}
+
+func newServer(t *testing.T) *glesystest.Server {
+	t.Helper()
+	s := glesystest.NewServer()
+	t.Cleanup(s.Close)
+	s.AddZone("example.com", testRecords...)
+	s.AddZone("example.org")
+	return s
+}
+
+// runCLI runs a command against the server and returns its output.
+func runCLI(t *testing.T, s *glesystest.Server, args ...string) (string, string, int) {
+	t.Helper()
+	return runCLIInput(t, s, "", args...)
+}
+
+// runCLIInput is runCLI with stdin reading input.
+func runCLIInput(t *testing.T, s *glesystest.Server, input string, args ...string) (string, string, int) {
+	t.Helper()
+	args = append([]string{args[0], "-project", s.Project, "-api-key", s.APIKey, "-base-url", s.URL}, args[1:]...)
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	code := run(context.Background(), args, strings.NewReader(input), stdout, stderr)
+	return stdout.String(), stderr.String(), code
+}
+
+// mustRun is runCLI that fails the test unless the command succeeds.
+func mustRun(t *testing.T, s *glesystest.Server, args ...string) string {
+	t.Helper()
+	stdout, stderr, code := runCLI(t, s, args...)
+	if code != 0 {
+		t.Fatalf("%v exited with %d: %s", args, code, stderr)
+	}
+	return stdout
+}
+
+func zoneRecords(s *glesystest.Server, zone string) []string {
+	records := []string{}
+	for _, r := range s.Records(zone) {
+		records = append(records, strings.Join([]string{r.Host, r.Type, r.Data}, " "))
+	}
+	return records
+}
+
+func TestZonesAndList(t *testing.T) {
+	s := newServer(t)
+
+	var zones []string
+	if err := json.Unmarshal([]byte(mustRun(t, s, "zones", "-o", "json")), &zones); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(zones, " ") != "example.com example.org" {
+		t.Errorf("zones = %v", zones)
+	}
+
+	got := mustRun(t, s, "list", "-name", "www", "-type", "a", "example.com.")
+	want := "NAME  TTL   TYPE  DATA\nwww   3600  A     192.0.2.1\nwww   3600  A     192.0.2.2\n"
+	if got != want {
+		t.Errorf("list = %q, want %q", got, want)
+	}
+
+	var records []record
+	if err := json.Unmarshal([]byte(mustRun(t, s, "list", "-o", "json", "example.com")), &records); err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != len(testRecords) || records[3] != (record{Name: "shop", TTL: 3600, Type: "CNAME", Data: "www.example.com."}) {
+		t.Errorf("list -o json = %+v", records)
+	}
+}
+
+func TestMutatingCommands(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want string
+		zone []string
+	}{
+		{"add", []string{"add", "-ttl", "5m", "example.com", "api", "A", "192.0.2.9"},
+			"+ api 300 A 192.0.2.9\nexample.com: 1 added, 0 updated, 0 deleted, 0 unchanged\n",
+			[]string{"@ NS ns1.namesystem.se.", "www A 192.0.2.1", "www A 192.0.2.2", "shop CNAME www.example.com.", "@ MX 10 mail.example.com.", `@ TXT v=spf1 include:"example.net" -all`, "api A 192.0.2.9"}},
+		{"set", []string{"set", "example.com", "www", "A", "192.0.2.2", "192.0.2.3"},
+			"~ www 3600 A 192.0.2.1 -> www 3600 A 192.0.2.3\nexample.com: 0 added, 1 updated, 0 deleted, 1 unchanged\n",
+			[]string{"@ NS ns1.namesystem.se.", "www A 192.0.2.3", "www A 192.0.2.2", "shop CNAME www.example.com.", "@ MX 10 mail.example.com.", `@ TXT v=spf1 include:"example.net" -all`}},
+		{"delete", []string{"delete", "example.com", "www", "A"},
+			"- www 3600 A 192.0.2.1\n- www 3600 A 192.0.2.2\nexample.com: 0 added, 0 updated, 2 deleted, 4 unchanged\n",
+			[]string{"@ NS ns1.namesystem.se.", "shop CNAME www.example.com.", "@ MX 10 mail.example.com.", `@ TXT v=spf1 include:"example.net" -all`}},
+		{"delete_data", []string{"delete", "example.com", "www", "A", "192.0.2.2"},
+			"- www 3600 A 192.0.2.2\nexample.com: 0 added, 0 updated, 1 deleted, 5 unchanged\n",
+			[]string{"@ NS ns1.namesystem.se.", "www A 192.0.2.1", "shop CNAME www.example.com.", "@ MX 10 mail.example.com.", `@ TXT v=spf1 include:"example.net" -all`}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newServer(t)
+			before := zoneRecords(s, "example.com")
+
+			// a dry run shows the same changes without making them
+			dry := append([]string{tt.args[0], "-dry-run"}, tt.args[1:]...)
+			got := mustRun(t, s, dry...)
+			if want := strings.Replace(tt.want, "example.com:", "example.com (dry run):", 1); got != want {
+				t.Errorf("%s -dry-run = %q, want %q", tt.name, got, want)
+			}
+			if after := zoneRecords(s, "example.com"); strings.Join(after, "\n") != strings.Join(before, "\n") {
+				t.Errorf("%s -dry-run changed the zone to %v", tt.name, after)
+			}
+
+			if got := mustRun(t, s, tt.args...); got != tt.want {
+				t.Errorf("%s = %q, want %q", tt.name, got, tt.want)
+			}
+			if got := zoneRecords(s, "example.com"); strings.Join(got, "\n") != strings.Join(tt.zone, "\n") {
+				t.Errorf("zone = %q, want %q", got, tt.zone)
+			}
+		})
+	}
+}
+
+func TestSetProtected(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		wantErr string
+		want    string
+	}{
+		{"apex_ns", []string{"set", "example.com", "@", "NS", "ns.example.net."}, "without -copy-protected", "@ NS ns1.namesystem.se."},
+		{"apex_soa", []string{"set", "example.com", "@", "soa", "ns.example.net. hostmaster.example.com. 1 2 3 4 5"}, "without -copy-protected", "@ NS ns1.namesystem.se."},
+		{"copy_protected", []string{"set", "-copy-protected", "example.com", "@", "NS", "ns.example.net."}, "", "@ NS ns.example.net."},
+		{"sub_ns", []string{"set", "example.com", "sub", "NS", "ns.example.net."}, "", "@ NS ns1.namesystem.se."},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newServer(t)
+
+			_, stderr, code := runCLI(t, s, tt.args...)
+
+			if tt.wantErr != "" {
+				if code == 0 || !strings.Contains(stderr, tt.wantErr) {
+					t.Errorf("%v exited with %d: %s, want %q", tt.args, code, stderr, tt.wantErr)
+				}
+			} else if code != 0 {
+				t.Fatalf("%v exited with %d: %s", tt.args, code, stderr)
+			}
+			if got := zoneRecords(s, "example.com")[0]; got != tt.want {
+				t.Errorf("apex NS = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExportImportDiff(t *testing.T) {
+	s := newServer(t)
+	dir := t.TempDir()
+	file := filepath.Join(dir, "example.com.zone")
+
+	export := mustRun(t, s, "export", "example.com")
+	if !strings.HasPrefix(export, "$ORIGIN example.com.\n@\t3600\tIN\tNS\tns1.namesystem.se.\n") ||
+		!strings.Contains(export, "@\t3600\tIN\tTXT\t\"v=spf1 include:\\\"example.net\\\" -all\"\n") {
+		t.Errorf("export = %q", export)
+	}
+	if err := os.WriteFile(file, []byte(export), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	// import into another zone, targets inside example.com are moved
+	mustRun(t, s, "import", "-copy-protected", "example.org", file)
+	want := []string{"@ NS ns1.namesystem.se.", "www A 192.0.2.1", "www A 192.0.2.2", "shop CNAME www.example.org.", "@ MX 10 mail.example.org.", `@ TXT v=spf1 include:"example.net" -all`}
+	if got := zoneRecords(s, "example.org"); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("imported zone = %q, want %q", got, want)
+	}
+	got := mustRun(t, s, "diff", file, "example.org")
+	if got != "--- "+file+"\n+++ example.org\n" {
+		t.Errorf("diff after import = %q", got)
+	}
+
+	mustRun(t, s, "add", "example.org", "extra", "TXT", "x")
+	got = mustRun(t, s, "import", "-prune", "-dry-run", "example.org", file)
+	if got != "- extra 3600 TXT x\nexample.org (dry run): 0 added, 0 updated, 1 deleted, 5 unchanged\n" {
+		t.Errorf("import -prune -dry-run = %q", got)
+	}
+	if _, stderr, code := runCLI(t, s, "import", "-prune", "-max-deletions", "1", "example.org", file); code != 0 {
+		t.Errorf("import -prune exited with %d: %s", code, stderr)
+	}
+
+	var d glesys.ZoneDiff
+	if err := json.Unmarshal([]byte(mustRun(t, s, "diff", "-o", "json", "example.com", "example.org")), &d); err != nil {
+		t.Fatal(err)
+	}
+	if !d.Empty() || d.Unchanged != 5 {
+		t.Errorf("diff -o json = %+v", d)
+	}
+}
+
+func TestImportSnapshot(t *testing.T) {
+	s := newServer(t)
+	snapshot, err := s.Provider().Backup(context.Background(), "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(t.TempDir(), "example.com.json")
+	f, err := os.Create(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := glesys.WriteSnapshot(f, snapshot); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	mustRun(t, s, "delete", "example.com", "www")
+
+	got := mustRun(t, s, "import", "example.com", file)
+
+	if got != "+ www 3600 A 192.0.2.1\n+ www 3600 A 192.0.2.2\nexample.com: 2 added, 0 updated, 0 deleted, 3 unchanged\n" {
+		t.Errorf("import = %q", got)
+	}
+}
+
+func TestPlanApply(t *testing.T) {
+	s := newServer(t)
+	dir := t.TempDir()
+	config := filepath.Join(dir, "example.com.yaml")
+	data := `
+zone: example.com
+ttl: 1h
+include: [mail.yaml]
+records:
+  www:
+    - {type: A, values: [192.0.2.1, 192.0.2.3]}
+  shop:
+    - {type: CNAME, data: www.example.com.}
+`
+	mail := `
+records:
+  "@":
+    - {type: MX, data: 10 mail.example.com.}
+    - {type: TXT, data: 'v=spf1 include:"example.net" -all'}
+`
+	for name, data := range map[string]string{config: data, filepath.Join(dir, "mail.yaml"): mail} {
+		if err := os.WriteFile(name, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	before := zoneRecords(s, "example.com")
+	wantPlan := "- www 3600 A 192.0.2.2\n+ www 3600 A 192.0.2.3\n"
+
+	if out := mustRun(t, s, "plan", config); !strings.HasSuffix(out, wantPlan) {
+		t.Errorf("plan = %q, want it to end with %q", out, wantPlan)
+	}
+	if out := mustRun(t, s, "apply", "-dry-run", config); !strings.Contains(out, wantPlan) {
+		t.Errorf("apply -dry-run = %q, want %q", out, wantPlan)
+	}
+	out, _, code := runCLIInput(t, s, "n\n", "apply", config)
+	if code != 1 || !strings.Contains(out, "Apply these changes to example.com? [y/N]") {
+		t.Errorf("declined apply exited with %d: %q", code, out)
+	}
+	if got := zoneRecords(s, "example.com"); strings.Join(got, ",") != strings.Join(before, ",") {
+		t.Errorf("zone changed to %v without confirmation", got)
+	}
+
+	out, stderr, code := runCLIInput(t, s, "yes\n", "apply", config)
+	if code != 0 {
+		t.Fatalf("apply exited with %d: %s", code, stderr)
+	}
+	if !strings.HasSuffix(out, "example.com: 0 added, 1 updated, 0 deleted, 4 unchanged\n") {
+		t.Errorf("apply = %q", out)
+	}
+	if out := mustRun(t, s, "apply", "-yes", config); out != "example.com: no changes\n" {
+		t.Errorf("repeated apply = %q", out)
+	}
+}
+
+func TestApplyMaxDeletions(t *testing.T) {
+	s := newServer(t)
+	config := filepath.Join(t.TempDir(), "example.com.yaml")
+	if err := os.WriteFile(config, []byte("zone: example.com\nrecords: {www: [{type: A, data: 192.0.2.1}]}\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	before := zoneRecords(s, "example.com")
+
+	out, stderr, code := runCLIInput(t, s, "y\n", "apply", "-max-deletions", "1", config)
+
+	if code != 1 || !strings.Contains(stderr, "too many deletions") {
+		t.Errorf("apply exited with %d: %s", code, stderr)
+	}
+	if strings.Contains(out, "Apply these changes") {
+		t.Errorf("apply asked for confirmation before refusing: %q", out)
+	}
+	if got := zoneRecords(s, "example.com"); strings.Join(got, ",") != strings.Join(before, ",") {
+		t.Errorf("zone changed to %v", got)
+	}
+}
+
+func TestUsage(t *testing.T) {
+	s := newServer(t)
+	tests := []struct {
+		name string
+		args []string
+		code int
+	}{
+		{"unknown_command", []string{"frobnicate"}, 2},
+		{"missing_argument", []string{"add", "example.com", "www", "A"}, 2},
+		{"unknown_output", []string{"list", "-o", "yaml", "example.com"}, 2},
+		{"invalid_record", []string{"add", "example.com", "www", "A", "not-an-ip"}, 1},
+		{"unknown_zone", []string{"list", "example.net"}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, stderr, code := runCLI(t, s, tt.args...)
+			if code != tt.code {
+				t.Errorf("exit code = %d, want %d: %s", code, tt.code, stderr)
+			}
+		})
+	}
+}
+
+func TestCredentials(t *testing.T) {
+	config := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(config, []byte(`{"project": "cl-file", "api_key": "file-key", "max_deletions": 5}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name        string
+		flagProject string
+		envProject  string
+		config      string
+		want        string
+		wantErr     bool
+	}{
+		{"flag", "cl-flag", "cl-env", config, "cl-flag", false},
+		{"env", "", "cl-env", config, "cl-env", false},
+		{"config", "", "", config, "cl-file", false},
+		{"missing_config", "", "", filepath.Join(t.TempDir(), "missing.json"), "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("GLESYS_PROJECT", tt.envProject)
+			t.Setenv("GLESYS_KEY", "")
+			e := &env{p: &glesys.Provider{Project: tt.flagProject}, config: tt.config}
+
+			p, err := e.provider()
+
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("provider() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if p.Project != tt.want || p.APIKey != "file-key" || p.MaxDeletions != 5 {
+				t.Errorf("provider() = %q %q %d", p.Project, p.APIKey, p.MaxDeletions)
+			}
+		})
+	}
+}
+
+func TestCredentialsDefaultConfig(t *testing.T) {
+	tests := []struct {
+		name             string
+		config           string
+		wantMaxDeletions int
+	}{
+		{"config", `{"project": "cl-file", "api_key": "file-key", "max_deletions": 5}`, 5},
+		{"settings_only", `{"max_deletions": 3}`, 3},
+		{"no_config", "", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			home := t.TempDir()
+			t.Setenv("HOME", home)
+			t.Setenv("XDG_CONFIG_HOME", filepath.Join(home, ".config"))
+			t.Setenv("AppData", filepath.Join(home, "AppData"))
+			t.Setenv("GLESYS_PROJECT", "cl-env")
+			t.Setenv("GLESYS_KEY", "env-key")
+			if tt.config != "" {
+				dir, err := os.UserConfigDir()
+				if err != nil {
+					t.Fatal(err)
+				}
+				name := filepath.Join(dir, "glesys-dns", "config.json")
+				if err := os.MkdirAll(filepath.Dir(name), 0o700); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(name, []byte(tt.config), 0o600); err != nil {
+					t.Fatal(err)
+				}
+			}
+			e := &env{p: &glesys.Provider{}}
+
+			p, err := e.provider()
+
+			if err != nil {
+				t.Fatalf("provider() error = %v", err)
+			}
+			if p.Project != "cl-env" || p.APIKey != "env-key" || p.MaxDeletions != tt.wantMaxDeletions {
+				t.Errorf("provider() = %q %q %d, want max deletions %d", p.Project, p.APIKey, p.MaxDeletions, tt.wantMaxDeletions)
+			}
+		})
+	}
+}
@@ -0,0 +1,266 @@
+// SPDX-FileCopyrightText: 2024 Peter Magnusson <me@kmpm.se>
+// SPDX-License-Identifier: MIT
+
+package glesys_test
+
+import (
+	"context"
+	"net/netip"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/libdns/glesys/glesystest"
+	"github.com/libdns/libdns"
+)
+
+// The conformance tests check that Provider implements the semantics
+// documented by the libdns interfaces. They run against glesystest so
+// no credentials or network are needed.
+
+func newConformanceServer(t *testing.T, records ...libdns.Record) *glesystest.Server {
+	t.Helper()
+	s := glesystest.NewServer()
+	t.Cleanup(s.Close)
+	s.AddZone("example.com", records...)
+	return s
+}
+
+func rrStrings(records []libdns.Record) []string {
+	out := []string{}
+	for _, r := range records {
+		rr := r.RR()
+		out = append(out, rr.Name+" "+rr.TTL.String()+" "+rr.Type+" "+rr.Data)
+	}
+	sort.Strings(out)
+	return out
+}
+
+func assertZone(t *testing.T, s *glesystest.Server, want ...libdns.Record) {
+	t.Helper()
+	got, err := s.Provider().GetRecords(context.Background(), "example.com")
+	if err != nil {
+		t.Fatalf("GetRecords() error = %v", err)
+	}
+	if !reflect.DeepEqual(rrStrings(got), rrStrings(want)) {
+		t.Errorf("Zone is\n%v\nwant\n%v", rrStrings(got), rrStrings(want))
+	}
+}
+
+func assertRecords(t *testing.T, name string, got []libdns.Record, want ...libdns.Record) {
+	t.Helper()
+	if !reflect.DeepEqual(rrStrings(got), rrStrings(want)) {
+		t.Errorf("%s returned\n%v\nwant\n%v", name, rrStrings(got), rrStrings(want))
+	}
+}
+
+// assertTyped checks that no opaque libdns.RR is returned for known types.
+func assertTyped(t *testing.T, name string, records []libdns.Record) {
+	t.Helper()
+	for _, r := range records {
+		if _, ok := r.(libdns.RR); ok {
+			t.Errorf("%s returned untyped record %+v", name, r)
+		}
+	}
+}
+
+func addr(name, ip string) libdns.Address {
+	return libdns.Address{Name: name, TTL: time.Hour, IP: netip.MustParseAddr(ip)}
+}
+
+func TestConformance_GetRecordsTyped(t *testing.T) {
+	records := []libdns.Record{
+		addr("@", "192.0.2.1"),
+		addr("@", "2001:db8::1"),
+		libdns.CNAME{Name: "www", TTL: time.Hour, Target: "example.com."},
+		libdns.MX{Name: "@", TTL: time.Hour, Preference: 10, Target: "mx.example.com."},
+		libdns.NS{Name: "@", TTL: time.Hour, Target: "ns1.namesystem.se."},
+		libdns.SRV{Service: "sip", Transport: "tcp", Name: "@", TTL: time.Hour, Priority: 10, Weight: 5, Port: 5060, Target: "sip.example.com."},
+		libdns.TXT{Name: "@", TTL: time.Hour, Text: "v=spf1 -all"},
+		libdns.CAA{Name: "@", TTL: time.Hour, Tag: "issue", Value: "letsencrypt.org"},
+	}
+	s := newConformanceServer(t, records...)
+
+	got, err := s.Provider().GetRecords(context.Background(), "example.com.")
+
+	if err != nil {
+		t.Fatalf("GetRecords() error = %v", err)
+	}
+	assertTyped(t, "GetRecords", got)
+	assertRecords(t, "GetRecords", got, records...)
+}
+
+func TestConformance_AppendRecords(t *testing.T) {
+	s := newConformanceServer(t, addr("www", "192.0.2.1"))
+	input := []libdns.Record{
+		addr("www", "192.0.2.2"),
+		libdns.TXT{Name: "_acme-challenge", TTL: time.Minute, Text: "token"},
+	}
+
+	got, err := s.Provider().AppendRecords(context.Background(), "example.com", input)
+
+	if err != nil {
+		t.Fatalf("AppendRecords() error = %v", err)
+	}
+	assertTyped(t, "AppendRecords", got)
+	assertRecords(t, "AppendRecords", got, input...)
+	assertZone(t, s, append(input, addr("www", "192.0.2.1"))...)
+}
+
+func TestConformance_SetRecords(t *testing.T) {
+	tests := []struct {
+		name    string
+		initial []libdns.Record
+		input   []libdns.Record
+		want    []libdns.Record
+	}{
+		{"replace_rrset",
+			[]libdns.Record{
+				addr("@", "192.0.2.1"),
+				addr("@", "192.0.2.2"),
+				libdns.TXT{Name: "@", TTL: time.Hour, Text: "hello world"},
+			},
+			[]libdns.Record{addr("@", "192.0.2.3")},
+			[]libdns.Record{
+				addr("@", "192.0.2.3"),
+				libdns.TXT{Name: "@", TTL: time.Hour, Text: "hello world"},
+			},
+		},
+		{"extend_rrset",
+			[]libdns.Record{
+				addr("a", "2001:db8::1"),
+				addr("a", "2001:db8::2"),
+				addr("b", "2001:db8::3"),
+				addr("b", "2001:db8::4"),
+			},
+			[]libdns.Record{
+				addr("a", "2001:db8::1"),
+				addr("a", "2001:db8::2"),
+				addr("a", "2001:db8::5"),
+			},
+			[]libdns.Record{
+				addr("a", "2001:db8::1"),
+				addr("a", "2001:db8::2"),
+				addr("a", "2001:db8::5"),
+				addr("b", "2001:db8::3"),
+				addr("b", "2001:db8::4"),
+			},
+		},
+		{"change_ttl",
+			[]libdns.Record{libdns.TXT{Name: "txt", TTL: time.Hour, Text: "a"}},
+			[]libdns.Record{libdns.TXT{Name: "txt", TTL: time.Minute, Text: "a"}},
+			[]libdns.Record{libdns.TXT{Name: "txt", TTL: time.Minute, Text: "a"}},
+		},
+		{"other_types_untouched",
+			[]libdns.Record{
+				addr("www", "192.0.2.1"),
+				libdns.TXT{Name: "www", TTL: time.Hour, Text: "a"},
+			},
+			[]libdns.Record{libdns.TXT{Name: "www", TTL: time.Hour, Text: "b"}},
+			[]libdns.Record{
+				addr("www", "192.0.2.1"),
+				libdns.TXT{Name: "www", TTL: time.Hour, Text: "b"},
+			},
+		},
+		{"new_rrset",
+			[]libdns.Record{},
+			[]libdns.Record{libdns.MX{Name: "@", TTL: time.Hour, Preference: 10, Target: "mx.example.com."}},
+			[]libdns.Record{libdns.MX{Name: "@", TTL: time.Hour, Preference: 10, Target: "mx.example.com."}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newConformanceServer(t, tt.initial...)
+
+			got, err := s.Provider().SetRecords(context.Background(), "example.com", tt.input)
+
+			if err != nil {
+				t.Fatalf("SetRecords() error = %v", err)
+			}
+			assertTyped(t, "SetRecords", got)
+			assertRecords(t, "SetRecords", got, tt.input...)
+			assertZone(t, s, tt.want...)
+		})
+	}
+}
+
+func TestConformance_DeleteRecords(t *testing.T) {
+	initial := []libdns.Record{
+		addr("www", "192.0.2.1"),
+		addr("www", "192.0.2.2"),
+		libdns.TXT{Name: "www", TTL: time.Minute, Text: "a"},
+		libdns.TXT{Name: "other", TTL: time.Minute, Text: "a"},
+	}
+	tests := []struct {
+		name  string
+		input []libdns.Record
+		want  []libdns.Record
+	}{
+		{"exact",
+			[]libdns.Record{addr("www", "192.0.2.1")},
+			[]libdns.Record{addr("www", "192.0.2.1")},
+		},
+		{"missing_is_ignored",
+			[]libdns.Record{addr("www", "192.0.2.9"), addr("www", "192.0.2.2")},
+			[]libdns.Record{addr("www", "192.0.2.2")},
+		},
+		{"ttl_must_match",
+			[]libdns.Record{libdns.TXT{Name: "www", TTL: time.Hour, Text: "a"}},
+			[]libdns.Record{},
+		},
+		{"empty_data",
+			[]libdns.Record{libdns.Address{Name: "www", TTL: time.Hour}},
+			[]libdns.Record{addr("www", "192.0.2.1"), addr("www", "192.0.2.2")},
+		},
+		{"empty_ttl",
+			[]libdns.Record{libdns.TXT{Name: "www", Text: "a"}},
+			[]libdns.Record{libdns.TXT{Name: "www", TTL: time.Minute, Text: "a"}},
+		},
+		{"empty_type",
+			[]libdns.Record{libdns.RR{Name: "www"}},
+			[]libdns.Record{
+				addr("www", "192.0.2.1"),
+				addr("www", "192.0.2.2"),
+				libdns.TXT{Name: "www", TTL: time.Minute, Text: "a"},
+			},
+		},
+		{"empty_name_never_matches",
+			[]libdns.Record{libdns.RR{Type: "TXT"}},
+			[]libdns.Record{},
+		},
+		{"duplicate_input",
+			[]libdns.Record{addr("www", "192.0.2.1"), addr("www", "192.0.2.1")},
+			[]libdns.Record{addr("www", "192.0.2.1")},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newConformanceServer(t, initial...)
+
+			got, err := s.Provider().DeleteRecords(context.Background(), "example.com", tt.input)
+
+			if err != nil {
+				t.Fatalf("DeleteRecords() error = %v", err)
+			}
+			assertTyped(t, "DeleteRecords", got)
+			assertRecords(t, "DeleteRecords", got, tt.want...)
+			remaining := []libdns.Record{}
+			for _, r := range initial {
+				if !slicesContainsRR(tt.want, r) {
+					remaining = append(remaining, r)
+				}
+			}
+			assertZone(t, s, remaining...)
+		})
+	}
+}
+
+func slicesContainsRR(records []libdns.Record, r libdns.Record) bool {
+	for _, x := range records {
+		if x.RR() == r.RR() {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,132 @@
+// SPDX-FileCopyrightText: 2024 Peter Magnusson <me@kmpm.se>
+// SPDX-License-Identifier: MIT
+
+package glesys_test
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/libdns/glesys/glesystest"
+	"github.com/libdns/libdns"
+)
+
+// Small pools make it likely that generated zones and inputs overlap.
+var (
+	genNames = []string{"@", "www", "mail", "api", "_acme-challenge"}
+	genTTLs  = []time.Duration{5 * time.Minute, time.Hour}
+	genData  = map[string][]string{
+		"A":    {"192.0.2.1", "192.0.2.2", "192.0.2.3", "192.0.2.4"},
+		"AAAA": {"2001:db8::1", "2001:db8::2", "2001:db8::3"},
+		"TXT":  {"a", "b", "c"},
+		"MX":   {"10 mx1.example.com.", "20 mx2.example.com."},
+	}
+	genTypes = []string{"A", "AAAA", "TXT", "MX"}
+)
+
+func pick[T any](r *rand.Rand, s []T) T {
+	return s[r.IntN(len(s))]
+}
+
+// genZone generates up to 15 random records, duplicates included.
+func genZone(r *rand.Rand) []libdns.Record {
+	records := []libdns.Record{}
+	for range r.IntN(16) {
+		typ := pick(r, genTypes)
+		records = append(records, libdns.RR{Name: pick(r, genNames), Type: typ, TTL: pick(r, genTTLs), Data: pick(r, genData[typ])})
+	}
+	return records
+}
+
+// genInput generates 1 to 3 random RRsets with 1 to 3 records each.
+func genInput(r *rand.Rand) []libdns.Record {
+	records := []libdns.Record{}
+	seen := map[string]bool{}
+	for range 1 + r.IntN(3) {
+		name, typ := pick(r, genNames), pick(r, genTypes)
+		if seen[name+typ] {
+			continue
+		}
+		seen[name+typ] = true
+		data := genData[typ]
+		for _, i := range r.Perm(len(data))[:1+r.IntN(min(3, len(data)))] {
+			records = append(records, libdns.RR{Name: name, Type: typ, TTL: pick(r, genTTLs), Data: data[i]})
+		}
+	}
+	r.Shuffle(len(records), func(i, j int) { records[i], records[j] = records[j], records[i] })
+	return records
+}
+
+// expectedZone replaces the RRsets of input in zone.
+func expectedZone(zone, input []libdns.Record) []string {
+	replaced := map[string]bool{}
+	for _, rec := range input {
+		replaced[rec.RR().Name+" "+rec.RR().Type] = true
+	}
+	want := []libdns.Record{}
+	for _, rec := range zone {
+		if !replaced[rec.RR().Name+" "+rec.RR().Type] {
+			want = append(want, rec)
+		}
+	}
+	return rrStrings(append(want, input...))
+}
+
+var mutatingEndpoints = []string{"domain/addrecord", "domain/updaterecord", "domain/deleterecord"}
+
+func TestProvider_SetRecordsConvergence(t *testing.T) {
+	for seed := range uint64(200) {
+		t.Run(fmt.Sprintf("seed_%d", seed), func(t *testing.T) {
+			r := rand.New(rand.NewPCG(seed, 0))
+			zone, input := genZone(r), genInput(r)
+			s := glesystest.NewServer()
+			defer s.Close()
+			s.AddZone("example.com", zone...)
+			p := s.Provider()
+			ctx := context.Background()
+
+			got, err := p.SetRecords(ctx, "example.com", input)
+			if err != nil {
+				t.Fatalf("SetRecords() error = %v", err)
+			}
+			assertRecords(t, "SetRecords", got, input...)
+			state := zoneState(s, "example.com")
+			want := expectedZone(zone, input)
+			if live, _ := p.GetRecords(ctx, "example.com"); !reflect.DeepEqual(rrStrings(live), want) {
+				t.Fatalf("Zone did not converge.\nzone:  %v\ninput: %v\ngot:   %v\nwant:  %v", rrStrings(zone), rrStrings(input), rrStrings(live), want)
+			}
+
+			// doing it again must not change anything
+			counter := s.Inject()
+			again, err := p.SetRecords(ctx, "example.com", input)
+			if err != nil {
+				t.Fatalf("repeated SetRecords() error = %v", err)
+			}
+			assertRecords(t, "repeated SetRecords", again, input...)
+			for _, endpoint := range mutatingEndpoints {
+				if n := counter.Count(endpoint); n != 0 {
+					t.Errorf("Repeated SetRecords made %d %s calls", n, endpoint)
+				}
+			}
+			if after := zoneState(s, "example.com"); !reflect.DeepEqual(after, state) {
+				t.Errorf("Repeated SetRecords changed the zone. Got %v, want %v", after, state)
+			}
+		})
+	}
+}
+
+func TestExpectedZone(t *testing.T) {
+	zone := []libdns.Record{
+		libdns.RR{Name: "www", Type: "A", TTL: time.Hour, Data: "192.0.2.1"},
+		libdns.RR{Name: "www", Type: "TXT", TTL: time.Hour, Data: "a"},
+	}
+	input := []libdns.Record{libdns.RR{Name: "www", Type: "A", TTL: time.Hour, Data: "192.0.2.2"}}
+	want := []string{"www 1h0m0s A 192.0.2.2", "www 1h0m0s TXT a"}
+	if got := expectedZone(zone, input); !reflect.DeepEqual(got, want) {
+		t.Errorf("expectedZone() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,214 @@
+// SPDX-FileCopyrightText: 2024 Peter Magnusson <me@kmpm.se>
+// SPDX-License-Identifier: MIT
+
+package glesys
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/libdns/glesys/internal/impl"
+	"github.com/libdns/libdns"
+)
+
+// DiffChange is how an RRset differs between two record sets.
+type DiffChange string
+
+const (
+	// DiffAdded means the RRset is only in To.
+	DiffAdded DiffChange = "added"
+	// DiffRemoved means the RRset is only in From.
+	DiffRemoved DiffChange = "removed"
+	// DiffChanged means the RRset is in both, with different data or TTLs.
+	DiffChanged DiffChange = "changed"
+)
+
+// DiffRecord is a record of an RRset in a diff. The TTL is in seconds
+// and the data is canonicalized.
+type DiffRecord struct {
+	TTL  int    `json:"ttl"`
+	Data string `json:"data"`
+}
+
+// RRsetDiff is an RRset that differs between two record sets. From and
+// To are the whole RRset on each side, sorted by data.
+type RRsetDiff struct {
+	Name   string       `json:"name"`
+	Type   string       `json:"type"`
+	Change DiffChange   `json:"change"`
+	From   []DiffRecord `json:"from"`
+	To     []DiffRecord `json:"to"`
+}
+
+// ZoneDiff is the difference between two record sets, grouped by RRset.
+// From and To label the sides, like a zone name or a snapshot file.
+type ZoneDiff struct {
+	From   string      `json:"from"`
+	To     string      `json:"to"`
+	RRsets []RRsetDiff `json:"rrsets"`
+	// Unchanged is the number of RRsets that are the same on both sides.
+	Unchanged int `json:"unchanged"`
+}
+
+// Empty returns true if the record sets are the same.
+func (d *ZoneDiff) Empty() bool {
+	return len(d.RRsets) == 0
+}
+
+// String formats the diff as text. Records only in From are prefixed
+// with -, records only in To with + and records with a changed TTL with ~.
+func (d *ZoneDiff) String() string {
+	sb := &strings.Builder{}
+	fmt.Fprintf(sb, "--- %s\n+++ %s\n", d.From, d.To)
+	for _, set := range d.RRsets {
+		to := map[string]DiffRecord{}
+		for _, r := range set.To {
+			to[r.Data] = r
+		}
+		for _, r := range set.From {
+			t, ok := to[r.Data]
+			switch {
+			case !ok:
+				fmt.Fprintf(sb, "- %s %d %s %s\n", set.Name, r.TTL, set.Type, r.Data)
+			case t.TTL != r.TTL:
+				fmt.Fprintf(sb, "~ %s %d -> %d %s %s\n", set.Name, r.TTL, t.TTL, set.Type, r.Data)
+			}
+		}
+		from := map[string]bool{}
+		for _, r := range set.From {
+			from[r.Data] = true
+		}
+		for _, r := range set.To {
+			if !from[r.Data] {
+				fmt.Fprintf(sb, "+ %s %d %s %s\n", set.Name, r.TTL, set.Type, r.Data)
+			}
+		}
+	}
+	return sb.String()
+}
+
+// canonicalRR returns the record with a lower case name, "@" for the
+// apex, an upper case type and data in the form libdns formats it, so
+// that equal records written differently compare equal. Domain names in
+// the data are compared ignoring case.
+func canonicalRR(r libdns.Record) libdns.RR {
+	rr := r.RR()
+	rr.Type = strings.ToUpper(rr.Type)
+	if parsed, err := rr.Parse(); err == nil && parsed.RR().Type == rr.Type {
+		rr.Data = parsed.RR().Data
+	}
+	rr.Name = strings.ToLower(rr.Name)
+	if rr.Name == "" {
+		rr.Name = "@"
+	}
+	switch rr.Type {
+	case "TXT":
+		// whitespace is part of the text
+	case "CNAME", "MX", "NS", "SRV", "PTR":
+		rr.Data = strings.ToLower(strings.Join(strings.Fields(rr.Data), " "))
+	default:
+		rr.Data = strings.Join(strings.Fields(rr.Data), " ")
+	}
+	return rr
+}
+
+// DiffRecords compares two record sets RRset by RRset. Records are
+// canonicalized before they are compared, see ZoneDiff for the result.
+// The diff is sorted by name and type.
+func DiffRecords(from, to []libdns.Record) *ZoneDiff {
+	type sides struct {
+		name, typ string
+		from, to  map[string]DiffRecord
+	}
+	sets := map[string]*sides{}
+	add := func(r libdns.Record, side func(*sides) map[string]DiffRecord) {
+		rr := canonicalRR(r)
+		key := nameTypeKey(rr.Name, rr.Type)
+		set, ok := sets[key]
+		if !ok {
+			set = &sides{name: rr.Name, typ: rr.Type, from: map[string]DiffRecord{}, to: map[string]DiffRecord{}}
+			sets[key] = set
+		}
+		side(set)[rr.Data] = DiffRecord{TTL: int(rr.TTL / time.Second), Data: rr.Data}
+	}
+	for _, r := range from {
+		add(r, func(s *sides) map[string]DiffRecord { return s.from })
+	}
+	for _, r := range to {
+		add(r, func(s *sides) map[string]DiffRecord { return s.to })
+	}
+
+	sorted := func(m map[string]DiffRecord) []DiffRecord {
+		records := make([]DiffRecord, 0, len(m))
+		for _, r := range m {
+			records = append(records, r)
+		}
+		slices.SortFunc(records, func(a, b DiffRecord) int { return strings.Compare(a.Data, b.Data) })
+		return records
+	}
+	d := &ZoneDiff{RRsets: []RRsetDiff{}}
+	for _, set := range sets {
+		diff := RRsetDiff{Name: set.name, Type: set.typ, From: sorted(set.from), To: sorted(set.to)}
+		switch {
+		case len(diff.From) == 0:
+			diff.Change = DiffAdded
+		case len(diff.To) == 0:
+			diff.Change = DiffRemoved
+		case slices.Equal(diff.From, diff.To):
+			d.Unchanged++
+			continue
+		default:
+			diff.Change = DiffChanged
+		}
+		d.RRsets = append(d.RRsets, diff)
+	}
+	slices.SortFunc(d.RRsets, func(a, b RRsetDiff) int {
+		return cmp.Or(strings.Compare(a.Name, b.Name), strings.Compare(a.Type, b.Type))
+	})
+	return d
+}
+
+// DiffZones compares fromZone, read from from, with toZone, read from to.
+// Either side may be a Provider, for the same or another GleSYS project,
+// a Snapshot or any other libdns provider. If the zone names differ,
+// targets inside fromZone are compared as if they were inside toZone,
+// like Clone rewrites them. SOA values are not compared.
+func DiffZones(ctx context.Context, from libdns.RecordGetter, fromZone string, to libdns.RecordGetter, toZone string) (*ZoneDiff, error) {
+	fromRecords, err := from.GetRecords(ctx, fromZone)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", fromZone, err)
+	}
+	toRecords, err := to.GetRecords(ctx, toZone)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", toZone, err)
+	}
+	if cleanZ(fromZone) != cleanZ(toZone) {
+		rewritten := make([]libdns.Record, len(fromRecords))
+		for i, r := range fromRecords {
+			rewritten[i] = rewriteRecord(r, fromZone, toZone)
+		}
+		fromRecords = rewritten
+	}
+	d := DiffRecords(fromRecords, toRecords)
+	d.From, d.To = cleanZ(fromZone), cleanZ(toZone)
+	return d, nil
+}
+
+// GetRecords returns the records of the snapshot, which makes a Snapshot
+// a libdns.RecordGetter that can be passed to DiffZones, Clone or Sync.
+// It fails if zone is not the zone of the snapshot.
+func (s *Snapshot) GetRecords(ctx context.Context, zone string) ([]libdns.Record, error) {
+	if !strings.EqualFold(cleanZ(zone), cleanZ(s.Zone)) {
+		return nil, fmt.Errorf("snapshot is of %s, not %s", s.Zone, cleanZ(zone))
+	}
+	records := make([]libdns.Record, 0, len(s.Records))
+	for _, r := range s.Records {
+		dr := impl.DNSDomainRecord{DomainName: s.Zone, Host: r.Name, Type: r.Type, TTL: r.TTL, Data: r.Data}
+		records = append(records, toLibDNSOrRR(&dr))
+	}
+	return records, nil
+}
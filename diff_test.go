@@ -0,0 +1,167 @@
+// SPDX-FileCopyrightText: 2024 Peter Magnusson <me@kmpm.se>
+// SPDX-License-Identifier: MIT
+
+package glesys_test
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/libdns/glesys"
+	"github.com/libdns/glesys/glesystest"
+	"github.com/libdns/libdns"
+)
+
+func TestDiffRecords(t *testing.T) {
+	tests := []struct {
+		name          string
+		from, to      []libdns.Record
+		want          []glesys.RRsetDiff
+		wantUnchanged int
+	}{
+		{"equal", []libdns.Record{addr("www", "192.0.2.1")}, []libdns.Record{addr("www", "192.0.2.1")}, []glesys.RRsetDiff{}, 1},
+		{"canonical",
+			[]libdns.Record{
+				libdns.RR{Name: "WWW", Type: "aaaa", TTL: time.Hour, Data: "2001:DB8:0:0::1"},
+				libdns.RR{Name: "", Type: "MX", TTL: time.Hour, Data: "10  Mail.Example.com."},
+				libdns.RR{Name: "spf", Type: "TXT", TTL: time.Hour, Data: "v=spf1  -all"},
+			},
+			[]libdns.Record{
+				libdns.RR{Name: "www", Type: "AAAA", TTL: time.Hour, Data: "2001:db8::1"},
+				libdns.MX{Name: "@", TTL: time.Hour, Preference: 10, Target: "mail.example.com."},
+				libdns.TXT{Name: "spf", TTL: time.Hour, Text: "v=spf1 -all"},
+			},
+			[]glesys.RRsetDiff{{Name: "spf", Type: "TXT", Change: glesys.DiffChanged,
+				From: []glesys.DiffRecord{{TTL: 3600, Data: "v=spf1  -all"}},
+				To:   []glesys.DiffRecord{{TTL: 3600, Data: "v=spf1 -all"}},
+			}}, 2},
+		{"grouped_by_rrset",
+			[]libdns.Record{addr("www", "192.0.2.2"), addr("www", "192.0.2.1"), addr("old", "192.0.2.1")},
+			[]libdns.Record{addr("www", "192.0.2.1"), addr("www", "192.0.2.3"), libdns.TXT{Name: "new", TTL: time.Minute, Text: "x"}},
+			[]glesys.RRsetDiff{
+				{Name: "new", Type: "TXT", Change: glesys.DiffAdded, From: []glesys.DiffRecord{}, To: []glesys.DiffRecord{{TTL: 60, Data: "x"}}},
+				{Name: "old", Type: "A", Change: glesys.DiffRemoved, From: []glesys.DiffRecord{{TTL: 3600, Data: "192.0.2.1"}}, To: []glesys.DiffRecord{}},
+				{Name: "www", Type: "A", Change: glesys.DiffChanged,
+					From: []glesys.DiffRecord{{TTL: 3600, Data: "192.0.2.1"}, {TTL: 3600, Data: "192.0.2.2"}},
+					To:   []glesys.DiffRecord{{TTL: 3600, Data: "192.0.2.1"}, {TTL: 3600, Data: "192.0.2.3"}},
+				},
+			}, 0},
+		{"ttl",
+			[]libdns.Record{addr("www", "192.0.2.1")},
+			[]libdns.Record{libdns.Address{Name: "www", TTL: time.Minute, IP: addr("www", "192.0.2.1").IP}},
+			[]glesys.RRsetDiff{{Name: "www", Type: "A", Change: glesys.DiffChanged,
+				From: []glesys.DiffRecord{{TTL: 3600, Data: "192.0.2.1"}},
+				To:   []glesys.DiffRecord{{TTL: 60, Data: "192.0.2.1"}},
+			}}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := glesys.DiffRecords(tt.from, tt.to)
+
+			if !reflect.DeepEqual(got.RRsets, tt.want) {
+				t.Errorf("DiffRecords() = %+v, want %+v", got.RRsets, tt.want)
+			}
+			if got.Unchanged != tt.wantUnchanged {
+				t.Errorf("DiffRecords() unchanged = %d, want %d", got.Unchanged, tt.wantUnchanged)
+			}
+			if got.Empty() != (len(tt.want) == 0) {
+				t.Errorf("Empty() = %v", got.Empty())
+			}
+		})
+	}
+}
+
+func TestZoneDiff_Output(t *testing.T) {
+	d := glesys.DiffRecords(
+		[]libdns.Record{addr("www", "192.0.2.1"), addr("www", "192.0.2.2"), addr("old", "192.0.2.1")},
+		[]libdns.Record{libdns.Address{Name: "www", TTL: time.Minute, IP: addr("www", "192.0.2.1").IP}, addr("www", "192.0.2.3")},
+	)
+	d.From, d.To = "prod.example.com", "staging.example.com"
+
+	want := "--- prod.example.com\n+++ staging.example.com\n" +
+		"- old 3600 A 192.0.2.1\n" +
+		"~ www 3600 -> 60 A 192.0.2.1\n" +
+		"- www 3600 A 192.0.2.2\n" +
+		"+ www 3600 A 192.0.2.3\n"
+	if got := d.String(); got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+
+	data, err := json.Marshal(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	read := &glesys.ZoneDiff{}
+	if err := json.Unmarshal(data, read); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(read, d) {
+		t.Errorf("JSON round trip = %+v, want %+v", read, d)
+	}
+}
+
+func TestDiffZones(t *testing.T) {
+	s := glesystest.NewServer()
+	defer s.Close()
+	s.AddZone("example.com",
+		addr("www", "192.0.2.1"),
+		libdns.CNAME{Name: "shop", TTL: time.Hour, Target: "www.example.com."},
+		libdns.TXT{Name: "old", TTL: time.Hour, Text: "x"},
+	)
+	s.AddZone("example.net",
+		addr("www", "192.0.2.1"),
+		libdns.CNAME{Name: "shop", TTL: time.Hour, Target: "www.example.net."},
+		libdns.TXT{Name: "new", TTL: time.Hour, Text: "y"},
+	)
+	p := s.Provider()
+	ctx := context.Background()
+
+	t.Run("zones", func(t *testing.T) {
+		d, err := glesys.DiffZones(ctx, p, "example.com.", p, "example.net.")
+		if err != nil {
+			t.Fatalf("DiffZones() error = %v", err)
+		}
+		// shop points inside each zone and is the same
+		want := "--- example.com\n+++ example.net\n+ new 3600 TXT y\n- old 3600 TXT x\n"
+		if d.String() != want || d.Unchanged != 2 {
+			t.Errorf("DiffZones() = %q (%d unchanged), want %q", d.String(), d.Unchanged, want)
+		}
+	})
+
+	t.Run("snapshots", func(t *testing.T) {
+		before, err := p.Backup(ctx, "example.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := p.AppendRecords(ctx, "example.com", []libdns.Record{addr("api", "192.0.2.5")}); err != nil {
+			t.Fatal(err)
+		}
+		after, err := p.Backup(ctx, "example.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		d, err := glesys.DiffZones(ctx, before, "example.com", after, "example.com")
+		if err != nil {
+			t.Fatalf("DiffZones() error = %v", err)
+		}
+		if want := "--- example.com\n+++ example.com\n+ api 3600 A 192.0.2.5\n"; d.String() != want {
+			t.Errorf("DiffZones() = %q, want %q", d.String(), want)
+		}
+
+		live, err := glesys.DiffZones(ctx, after, "example.com", p, "example.com")
+		if err != nil {
+			t.Fatalf("DiffZones() error = %v", err)
+		}
+		if !live.Empty() {
+			t.Errorf("DiffZones() snapshot against live zone = %q", live)
+		}
+
+		if _, err := glesys.DiffZones(ctx, before, "example.net", p, "example.net"); err == nil {
+			t.Errorf("DiffZones() with a snapshot of another zone did not fail")
+		}
+	})
+}
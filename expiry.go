@@ -0,0 +1,127 @@
+// SPDX-FileCopyrightText: 2024 Peter Magnusson <me@kmpm.se>
+// SPDX-License-Identifier: MIT
+
+package glesys
+
+import (
+	"context"
+	"log"
+	"slices"
+	"time"
+)
+
+// ExpiryIssue is a reason a domain is listed as needing attention.
+type ExpiryIssue string
+
+const (
+	// IssueExpiring means the registration expires within the window,
+	// or already has.
+	IssueExpiring ExpiryIssue = "expiring"
+	// IssueAutoRenewOff means the domain will not be renewed automatically.
+	IssueAutoRenewOff ExpiryIssue = "autorenew_off"
+	// IssueState means the registrar state is not OK.
+	IssueState ExpiryIssue = "state"
+	// IssueUnknownExpiry means GleSYS gave no usable expiry date.
+	IssueUnknownExpiry ExpiryIssue = "unknown_expiry"
+)
+
+// DomainExpiry is the registration status of a domain.
+type DomainExpiry struct {
+	Name             string        `json:"name"`
+	State            string        `json:"state"`
+	StateDescription string        `json:"state_description,omitempty"`
+	AutoRenew        bool          `json:"autorenew"`
+	Expires          time.Time     `json:"expires"`
+	Issues           []ExpiryIssue `json:"issues"`
+}
+
+// ExpiryReport is the registration status of all domains in the project
+// that are registered through GleSYS.
+type ExpiryReport struct {
+	GeneratedAt time.Time `json:"generated_at"`
+	// Until is the end of the window domains are expiring within.
+	Until   time.Time      `json:"until"`
+	Domains []DomainExpiry `json:"domains"`
+}
+
+// Problems returns the domains that have any issues.
+func (r *ExpiryReport) Problems() []DomainExpiry {
+	problems := []DomainExpiry{}
+	for _, d := range r.Domains {
+		if len(d.Issues) > 0 {
+			problems = append(problems, d)
+		}
+	}
+	return problems
+}
+
+// CheckExpiry reports the registration status of all domains in the
+// project, flagging domains that expire within window, have auto-renew
+// turned off or are in a registrar state other than OK. Domains not
+// registered through GleSYS are left out. The details of a domain are only
+// fetched if the list has its registrar state but no expiry date.
+func (p *Provider) CheckExpiry(ctx context.Context, window time.Duration) (*ExpiryReport, error) {
+	ctx, span := p.startSpan(ctx, "CheckExpiry", "", nil)
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	report, err := p.checkExpiry(ctx, time.Now(), window)
+	endSpan(span, nil, err)
+	return report, err
+}
+
+func (p *Provider) checkExpiry(ctx context.Context, now time.Time, window time.Duration) (*ExpiryReport, error) {
+	if debug {
+		log.Printf("CheckExpiry window=%v", window)
+	}
+	domains, err := p.client().DNSDomains.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	report := &ExpiryReport{
+		GeneratedAt: now,
+		Until:       now.Add(window),
+		Domains:     []DomainExpiry{},
+	}
+	for _, d := range *domains {
+		if d.RegistrarInfo.State == "" {
+			// not registered through GleSYS
+			continue
+		}
+		if d.RegistrarInfo.Expire == "" {
+			// the list may leave out the expiry date, the details do not
+			details, err := p.client().DNSDomains.Details(ctx, d.Name)
+			if err != nil {
+				return nil, err
+			}
+			d = *details
+		}
+		z := toZone(&d)
+		if z.Registration == nil {
+			continue
+		}
+		reg := z.Registration
+		e := DomainExpiry{
+			Name:             z.Name,
+			State:            reg.State,
+			StateDescription: reg.StateDescription,
+			AutoRenew:        reg.AutoRenew,
+			Expires:          reg.Expires,
+			Issues:           []ExpiryIssue{},
+		}
+		switch {
+		case reg.Expires.IsZero():
+			e.Issues = append(e.Issues, IssueUnknownExpiry)
+		case !reg.Expires.After(report.Until):
+			e.Issues = append(e.Issues, IssueExpiring)
+		}
+		if !reg.AutoRenew {
+			e.Issues = append(e.Issues, IssueAutoRenewOff)
+		}
+		if reg.State != "OK" {
+			e.Issues = append(e.Issues, IssueState)
+		}
+		report.Domains = append(report.Domains, e)
+	}
+	slices.SortStableFunc(report.Domains, func(a, b DomainExpiry) int { return a.Expires.Compare(b.Expires) })
+	return report, nil
+}
@@ -0,0 +1,77 @@
+// SPDX-FileCopyrightText: 2024 Peter Magnusson <me@kmpm.se>
+// SPDX-License-Identifier: MIT
+
+package glesys_test
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/libdns/glesys"
+	"github.com/libdns/glesys/glesystest"
+)
+
+func TestProvider_CheckExpiry(t *testing.T) {
+	day := 24 * time.Hour
+	today := time.Now().UTC().Truncate(day)
+	s := glesystest.NewServer()
+	defer s.Close()
+	s.AddZone("fine.com")
+	s.AddZone("soon.com")
+	s.SetRegistration("soon.com", glesystest.Registration{State: "OK", AutoRenew: true, Expires: today.Add(10 * day)})
+	s.AddZone("manual.com")
+	s.SetRegistration("manual.com", glesystest.Registration{State: "OK", Expires: today.Add(100 * day)})
+	s.AddZone("expired.com")
+	s.SetRegistration("expired.com", glesystest.Registration{State: "EXPIRED", Expires: today.Add(-5 * day)})
+	s.AddZone("external.com")
+	s.SetRegistration("external.com", glesystest.Registration{})
+
+	counter := s.Inject()
+
+	report, err := s.Provider().CheckExpiry(context.Background(), 30*day)
+
+	if err != nil {
+		t.Fatalf("CheckExpiry() error = %v", err)
+	}
+	if n := counter.Count("domain/details"); n != 0 {
+		t.Errorf("CheckExpiry() made %d domain/details calls, want 0", n)
+	}
+	got := map[string][]glesys.ExpiryIssue{}
+	names := []string{}
+	for _, d := range report.Domains {
+		got[d.Name] = d.Issues
+		names = append(names, d.Name)
+	}
+	want := map[string][]glesys.ExpiryIssue{
+		"expired.com": {glesys.IssueExpiring, glesys.IssueAutoRenewOff, glesys.IssueState},
+		"soon.com":    {glesys.IssueExpiring},
+		"manual.com":  {glesys.IssueAutoRenewOff},
+		"fine.com":    {},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("CheckExpiry() issues = %v, want %v", got, want)
+	}
+	if wantNames := []string{"expired.com", "soon.com", "manual.com", "fine.com"}; !reflect.DeepEqual(names, wantNames) {
+		t.Errorf("Domains are ordered %v, want %v", names, wantNames)
+	}
+	if n := len(report.Problems()); n != 3 {
+		t.Errorf("Problems() returned %d domains, want 3", n)
+	}
+	if got := report.Domains[1].Expires; !got.Equal(today.Add(10 * day)) {
+		t.Errorf("Expires = %v, want %v", got, today.Add(10*day))
+	}
+
+	b, err := json.Marshal(report)
+	if err != nil {
+		t.Fatalf("json.Marshal() error = %v", err)
+	}
+	for _, want := range []string{`"name":"expired.com"`, `"issues":["expiring","autorenew_off","state"]`, `"until":`} {
+		if !strings.Contains(string(b), want) {
+			t.Errorf("JSON report %s does not contain %s", b, want)
+		}
+	}
+}
@@ -0,0 +1,203 @@
+// SPDX-FileCopyrightText: 2024 Peter Magnusson <me@kmpm.se>
+// SPDX-License-Identifier: MIT
+
+package glesystest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/libdns/glesys"
+)
+
+// FaultKind is the kind of failure a Fault injects.
+type FaultKind int
+
+const (
+	// FaultError fails the call with an HTTP 500 error envelope.
+	FaultError FaultKind = iota
+	// FaultMalformed answers the call with a truncated JSON body.
+	FaultMalformed
+	// FaultDelay holds the call for Fault.Delay before handling it,
+	// or until the request context is done.
+	FaultDelay
+	// FaultSlowResponse handles the call and then holds the response for
+	// Fault.Delay, or until the request context is done. The call is
+	// applied even if the client gives up waiting for the response.
+	FaultSlowResponse
+)
+
+func (k FaultKind) String() string {
+	switch k {
+	case FaultError:
+		return "error"
+	case FaultMalformed:
+		return "malformed"
+	case FaultDelay:
+		return "delay"
+	case FaultSlowResponse:
+		return "slow_response"
+	default:
+		return fmt.Sprintf("FaultKind(%d)", int(k))
+	}
+}
+
+// Fault describes a failure to inject into the Nth call to an endpoint.
+// A faulted call is never applied to the zone state, except for a
+// FaultDelay that runs to completion before the client gives up and a
+// FaultSlowResponse.
+type Fault struct {
+	// Endpoint is the API path, e.g. "domain/addrecord".
+	Endpoint string
+	// Nth is the 1-based number of the call to Endpoint that fails.
+	Nth int
+	// Kind of failure.
+	Kind FaultKind
+	// Delay is how long a FaultDelay or FaultSlowResponse holds the call.
+	Delay time.Duration
+}
+
+func (f Fault) String() string {
+	return fmt.Sprintf("%s #%d %s", f.Endpoint, f.Nth, f.Kind)
+}
+
+// Injector counts calls per endpoint and injects scripted faults.
+// It can be used on a Server with Server.Inject or on the client side
+// as a glesys.Middleware.
+type Injector struct {
+	mutex  sync.Mutex
+	faults []Fault
+	counts map[string]int
+}
+
+// NewInjector returns an Injector with the given faults.
+func NewInjector(faults ...Fault) *Injector {
+	return &Injector{faults: faults, counts: map[string]int{}}
+}
+
+// Add adds a fault to the script.
+func (i *Injector) Add(f Fault) {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	i.faults = append(i.faults, f)
+}
+
+// Count returns the number of calls seen for endpoint.
+func (i *Injector) Count(endpoint string) int {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	return i.counts[endpoint]
+}
+
+// next counts a call to endpoint and returns the fault to inject, if any.
+func (i *Injector) next(endpoint string) (Fault, bool) {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	endpoint = strings.TrimPrefix(endpoint, "/")
+	i.counts[endpoint]++
+	for _, f := range i.faults {
+		if f.Endpoint == endpoint && f.Nth == i.counts[endpoint] {
+			return f, true
+		}
+	}
+	return Fault{}, false
+}
+
+// Middleware injects the faults on the client side, before any request
+// is sent, so the API never sees a faulted call. The exception is
+// FaultSlowResponse, whose call is sent and completed whether or not the
+// client gives up waiting.
+func (i *Injector) Middleware(next glesys.Handler) glesys.Handler {
+	return func(call *glesys.Call) error {
+		f, ok := i.next(call.Path)
+		if !ok {
+			return next(call)
+		}
+		switch f.Kind {
+		case FaultMalformed:
+			if call.Result == nil {
+				return fmt.Errorf("injected fault: %s", f)
+			}
+			return json.Unmarshal([]byte(malformedBody), call.Result)
+		case FaultDelay:
+			select {
+			case <-time.After(f.Delay):
+				return next(call)
+			case <-call.Request.Context().Done():
+				return call.Request.Context().Err()
+			}
+		case FaultSlowResponse:
+			// the call is made with a context the client cannot cancel
+			ctx := call.Request.Context()
+			call.Request = call.Request.WithContext(context.WithoutCancel(ctx))
+			err := next(call)
+			select {
+			case <-time.After(f.Delay):
+				return err
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		default:
+			return fmt.Errorf("injected fault: %s", f)
+		}
+	}
+}
+
+// Inject makes the Server fail calls according to the faults.
+// It returns the Injector so more faults can be added and calls counted.
+func (s *Server) Inject(faults ...Fault) *Injector {
+	i := NewInjector(faults...)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.injector = i
+	return i
+}
+
+const malformedBody = `{"response": {"status": {"code": 200, "text": "OK"}, "record": {"recordid": `
+
+// inject handles a faulted call on the server side. It returns true if the
+// response has been written. serve handles a call normally.
+func (i *Injector) inject(w http.ResponseWriter, r *http.Request, serve http.HandlerFunc) bool {
+	f, ok := i.next(r.URL.Path)
+	if !ok {
+		return false
+	}
+	switch f.Kind {
+	case FaultMalformed:
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(malformedBody))
+	case FaultDelay:
+		// the server only notices a cancelled request once the body is read
+		body, _ := io.ReadAll(r.Body)
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		select {
+		case <-time.After(f.Delay):
+			return false
+		case <-r.Context().Done():
+			writeError(w, http.StatusServiceUnavailable, "Request cancelled")
+		}
+	case FaultSlowResponse:
+		rec := httptest.NewRecorder()
+		serve(rec, r)
+		select {
+		case <-time.After(f.Delay):
+		case <-r.Context().Done():
+		}
+		for k, v := range rec.Header() {
+			w.Header()[k] = v
+		}
+		w.WriteHeader(rec.Code)
+		w.Write(rec.Body.Bytes())
+	default:
+		writeError(w, http.StatusInternalServerError, "Injected fault: "+f.String())
+	}
+	return true
+}
@@ -0,0 +1,685 @@
+// SPDX-FileCopyrightText: 2024 Peter Magnusson <me@kmpm.se>
+// SPDX-License-Identifier: MIT
+
+// Package glesystest provides an in-process fake of the GleSYS DNS API
+// for testing code that uses the glesys provider without credentials.
+package glesystest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/libdns/glesys"
+	"github.com/libdns/glesys/internal/impl"
+	"github.com/libdns/libdns"
+)
+
+const (
+	// DefaultProject is the project/username the Server accepts by default.
+	DefaultProject = "cl12345"
+	// DefaultAPIKey is the API key the Server accepts by default.
+	DefaultAPIKey = "glesystest-key"
+	// DefaultTTL is the TTL in seconds given to records added without one.
+	DefaultTTL = 3600
+)
+
+// Record is a record stored in the fake API.
+type Record struct {
+	ID   int
+	Host string
+	Type string
+	Data string
+	TTL  int
+}
+
+// Server is a stateful fake of the GleSYS DNS API.
+type Server struct {
+	*httptest.Server
+
+	// Project and APIKey are the basic-auth credentials that are accepted.
+	Project string
+	APIKey  string
+
+	mutex    sync.Mutex
+	zones    map[string]*zone
+	nextID   int
+	handler  http.Handler
+	injector *Injector
+}
+
+type zone struct {
+	domain      impl.DNSDomain
+	records     []impl.DNSDomainRecord
+	nameservers []string
+}
+
+// NewServer starts and returns a new Server without any zones.
+// The caller should call Close when finished, to shut it down.
+func NewServer() *Server {
+	s := &Server{
+		Project: DefaultProject,
+		APIKey:  DefaultAPIKey,
+		zones:   map[string]*zone{},
+		nextID:  1000001,
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/domain/list", s.handleList)
+	mux.HandleFunc("/domain/add", s.handleAdd)
+	mux.HandleFunc("/domain/delete", s.handleDelete)
+	mux.HandleFunc("/domain/details", s.handleDetails)
+	mux.HandleFunc("/domain/edit", s.handleEdit)
+	mux.HandleFunc("/domain/changenameservers", s.handleChangeNameservers)
+	mux.HandleFunc("/domain/available", s.handleAvailable)
+	mux.HandleFunc("/domain/register", s.handleRegister)
+	mux.HandleFunc("/domain/transfer", s.handleRegister)
+	mux.HandleFunc("/domain/renew", s.handleRenew)
+	mux.HandleFunc("/domain/setautorenew", s.handleSetAutoRenew)
+	mux.HandleFunc("/domain/generateauthcode", s.handleGenerateAuthCode)
+	mux.HandleFunc("/domain/export", s.handleExport)
+	mux.HandleFunc("/domain/listrecords", s.handleListRecords)
+	mux.HandleFunc("/domain/addrecord", s.handleAddRecord)
+	mux.HandleFunc("/domain/updaterecord", s.handleUpdateRecord)
+	mux.HandleFunc("/domain/deleterecord", s.handleDeleteRecord)
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, http.StatusNotFound, "Unknown API endpoint: "+r.URL.Path)
+	})
+	s.handler = mux
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// Provider returns a Provider configured to use the Server.
+func (s *Server) Provider() *glesys.Provider {
+	return &glesys.Provider{
+		Project: s.Project,
+		APIKey:  s.APIKey,
+		BaseURL: s.URL,
+	}
+}
+
+// AddZone adds a zone with the given records, replacing any existing
+// zone with the same name.
+func (s *Server) AddZone(name string, records ...libdns.Record) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	name = strings.TrimRight(name, ". ")
+	z := &zone{domain: newDomain(name)}
+	s.zones[name] = z
+	for _, r := range records {
+		rr := r.RR()
+		ttl := int(rr.TTL / time.Second)
+		if ttl == 0 {
+			ttl = DefaultTTL
+		}
+		s.addRecord(z, rr.Name, strings.ToUpper(rr.Type), rr.Data, ttl)
+	}
+}
+
+// RemoveZone removes a zone and all its records.
+func (s *Server) RemoveZone(name string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.zones, strings.TrimRight(name, ". "))
+}
+
+// Records returns the records currently in the zone ordered by ID,
+// or nil if there is no such zone.
+func (s *Server) Records(name string) []Record {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	z, ok := s.zones[strings.TrimRight(name, ". ")]
+	if !ok {
+		return nil
+	}
+	records := make([]Record, 0, len(z.records))
+	for _, dr := range z.records {
+		records = append(records, Record{ID: dr.RecordID, Host: dr.Host, Type: dr.Type, Data: dr.Data, TTL: dr.TTL})
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].ID < records[j].ID })
+	return records
+}
+
+// Registration is the registrar information of a zone.
+type Registration struct {
+	State     string
+	AutoRenew bool
+	Expires   time.Time
+}
+
+// SetRegistration changes the registrar information of a zone. A zero
+// Registration makes the zone not registered through GleSYS.
+func (s *Server) SetRegistration(name string, reg Registration) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	z, ok := s.zones[strings.TrimRight(name, ". ")]
+	if !ok {
+		return
+	}
+	if reg == (Registration{}) {
+		z.domain.RegistrarInfo = impl.RegistrarInfo{}
+		return
+	}
+	ri := &z.domain.RegistrarInfo
+	ri.State = reg.State
+	ri.AutoRenew = "no"
+	if reg.AutoRenew {
+		ri.AutoRenew = "yes"
+	}
+	ri.Expire = reg.Expires.Format(time.DateOnly)
+	ri.TLD = z.domain.Name[strings.LastIndex(z.domain.Name, ".")+1:]
+}
+
+// Nameservers returns the name servers last set with domain/changenameservers
+// for the zone, or nil if they have not been changed.
+func (s *Server) Nameservers(name string) []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	z, ok := s.zones[strings.TrimRight(name, ". ")]
+	if !ok {
+		return nil
+	}
+	return slices.Clone(z.nameservers)
+}
+
+func newDomain(name string) impl.DNSDomain {
+	return impl.DNSDomain{
+		Name:                  name,
+		DisplayName:           name,
+		CreateTime:            time.Now().UTC().Format(time.RFC3339),
+		UsingGlesysNameserver: "yes",
+		PrimaryNameServer:     "ns1.namesystem.se.",
+		ResponsiblePerson:     "registry.glesys.se.",
+		TTL:                   3600,
+		Refresh:               10800,
+		Retry:                 2700,
+		Expire:                1814400,
+		Minimum:               10800,
+		RegistrarInfo: impl.RegistrarInfo{
+			AutoRenew: "yes",
+			State:     "OK",
+			Expire:    time.Now().AddDate(1, 0, 0).Format("2006-01-02"),
+			TLD:       name[strings.LastIndex(name, ".")+1:],
+		},
+	}
+}
+
+// addRecord must be called with the mutex held.
+func (s *Server) addRecord(z *zone, host, typ, data string, ttl int) impl.DNSDomainRecord {
+	dr := impl.DNSDomainRecord{
+		DomainName: z.domain.Name,
+		RecordID:   s.nextID,
+		Host:       host,
+		Type:       typ,
+		Data:       data,
+		TTL:        ttl,
+	}
+	s.nextID++
+	z.records = append(z.records, dr)
+	return dr
+}
+
+// findRecord must be called with the mutex held.
+func (s *Server) findRecord(id int) (*zone, int) {
+	for _, z := range s.zones {
+		for i, dr := range z.records {
+			if dr.RecordID == id {
+				return z, i
+			}
+		}
+	}
+	return nil, -1
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	project, key, ok := r.BasicAuth()
+	if !ok || project != s.Project || key != s.APIKey {
+		writeError(w, http.StatusUnauthorized, "Invalid API key or project")
+		return
+	}
+	s.mutex.Lock()
+	injector := s.injector
+	s.mutex.Unlock()
+	if injector != nil && injector.inject(w, r, s.serveLocked) {
+		return
+	}
+	s.serveLocked(w, r)
+}
+
+func (s *Server) serveLocked(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.handler.ServeHTTP(w, r)
+}
+
+func (s *Server) handleList(w http.ResponseWriter, r *http.Request) {
+	domains := []impl.DNSDomain{}
+	for _, z := range s.zones {
+		d := z.domain
+		d.RecordCount = len(z.records)
+		domains = append(domains, d)
+	}
+	sort.Slice(domains, func(i, j int) bool { return domains[i].Name < domains[j].Name })
+	writeResponse(w, map[string]interface{}{"domains": domains})
+}
+
+// defaultRecords are added to zones created through domain/add unless
+// createrecords is "no".
+var defaultRecords = []impl.DNSDomainRecord{
+	{Host: "@", Type: "NS", Data: "ns1.namesystem.se."},
+	{Host: "@", Type: "NS", Data: "ns2.namesystem.se."},
+	{Host: "@", Type: "NS", Data: "ns3.namesystem.se."},
+}
+
+func (s *Server) handleAdd(w http.ResponseWriter, r *http.Request) {
+	var params impl.AddDNSDomainParams
+	if !decode(w, r, &params) {
+		return
+	}
+	if params.Name == "" {
+		writeError(w, http.StatusBadRequest, "Argument domainname is required")
+		return
+	}
+	if _, ok := s.zones[params.Name]; ok {
+		writeError(w, http.StatusBadRequest, "Domain already exists: "+params.Name)
+		return
+	}
+	d := newDomain(params.Name)
+	editDomain(&d, impl.EditDNSDomainParams{
+		PrimaryNameServer: params.PrimaryNameServer,
+		ResponsiblePerson: params.ResponsiblePerson,
+		TTL:               params.TTL,
+		Refresh:           params.Refresh,
+		Retry:             params.Retry,
+		Expire:            params.Expire,
+		Minimum:           params.Minimum,
+	})
+	// zones added to the account are not registered through GleSYS
+	d.RegistrarInfo = impl.RegistrarInfo{}
+	z := &zone{domain: d}
+	s.zones[params.Name] = z
+	if params.CreateRecords != "no" {
+		for _, dr := range defaultRecords {
+			s.addRecord(z, dr.Host, dr.Type, dr.Data, d.TTL)
+		}
+	}
+	d.RecordCount = len(z.records)
+	writeResponse(w, map[string]interface{}{"domain": d})
+}
+
+func (s *Server) handleDelete(w http.ResponseWriter, r *http.Request) {
+	var params impl.DeleteDNSDomainParams
+	if !decode(w, r, &params) {
+		return
+	}
+	if _, ok := s.zones[params.Name]; !ok {
+		writeError(w, http.StatusNotFound, "Domain not found: "+params.Name)
+		return
+	}
+	delete(s.zones, params.Name)
+	writeResponse(w, map[string]interface{}{})
+}
+
+func (s *Server) handleEdit(w http.ResponseWriter, r *http.Request) {
+	var params impl.EditDNSDomainParams
+	if !decode(w, r, &params) {
+		return
+	}
+	z, ok := s.zones[params.Name]
+	if !ok {
+		writeError(w, http.StatusNotFound, "Domain not found: "+params.Name)
+		return
+	}
+	editDomain(&z.domain, params)
+	d := z.domain
+	d.RecordCount = len(z.records)
+	writeResponse(w, map[string]interface{}{"domain": d})
+}
+
+func (s *Server) handleChangeNameservers(w http.ResponseWriter, r *http.Request) {
+	var params impl.ChangeNameserverParams
+	if !decode(w, r, &params) {
+		return
+	}
+	z, ok := s.zones[params.DomainName]
+	if !ok {
+		writeError(w, http.StatusNotFound, "Domain not found: "+params.DomainName)
+		return
+	}
+	if params.NS1 == "" || params.NS2 == "" {
+		writeError(w, http.StatusBadRequest, "Arguments ns1 and ns2 are required")
+		return
+	}
+	z.nameservers = []string{}
+	onGlesys := true
+	for _, ns := range []string{params.NS1, params.NS2, params.NS3, params.NS4} {
+		if ns != "" {
+			z.nameservers = append(z.nameservers, ns)
+			onGlesys = onGlesys && strings.HasSuffix(strings.TrimRight(ns, "."), ".namesystem.se")
+		}
+	}
+	z.domain.UsingGlesysNameserver = "no"
+	if onGlesys {
+		z.domain.UsingGlesysNameserver = "yes"
+	}
+	writeResponse(w, map[string]interface{}{})
+}
+
+// Prices are the yearly prices the Server quotes for every domain.
+var Prices = []glesys.Price{
+	{Amount: 150, Currency: "SEK", Years: 1},
+	{Amount: 300, Currency: "SEK", Years: 2},
+}
+
+// registered returns true if the zone is registered through GleSYS.
+func (z *zone) registered() bool {
+	return z.domain.RegistrarInfo.State != ""
+}
+
+func (s *Server) handleAvailable(w http.ResponseWriter, r *http.Request) {
+	var params struct {
+		Search string `json:"search"`
+	}
+	if !decode(w, r, &params) {
+		return
+	}
+	if params.Search == "" {
+		writeError(w, http.StatusBadRequest, "Argument search is required")
+		return
+	}
+	z, ok := s.zones[params.Search]
+	d := impl.DNSDomain{
+		Name:      params.Search,
+		Available: !ok || !z.registered(),
+		Prices:    make([]impl.DNSDomainPrice, 0, len(Prices)),
+	}
+	for _, price := range Prices {
+		d.Prices = append(d.Prices, impl.DNSDomainPrice(price))
+	}
+	writeResponse(w, map[string]interface{}{"domain": []impl.DNSDomain{d}})
+}
+
+// handleRegister handles both domain/register and domain/transfer.
+func (s *Server) handleRegister(w http.ResponseWriter, r *http.Request) {
+	var params impl.RegisterDNSDomainParams
+	if !decode(w, r, &params) {
+		return
+	}
+	if params.Name == "" || params.Email == "" {
+		writeError(w, http.StatusBadRequest, "Arguments domainname and email are required")
+		return
+	}
+	state := "OK"
+	if strings.HasSuffix(r.URL.Path, "/transfer") {
+		if params.AuthCode == "" {
+			writeError(w, http.StatusBadRequest, "Argument authcode is required")
+			return
+		}
+		state = "PENDING TRANSFER"
+	}
+	z, ok := s.zones[params.Name]
+	if ok && z.registered() {
+		writeError(w, http.StatusBadRequest, "Domain is already registered: "+params.Name)
+		return
+	}
+	if !ok {
+		z = &zone{domain: newDomain(params.Name)}
+		s.zones[params.Name] = z
+	}
+	years := max(params.NumYears, 1)
+	z.domain.RegistrarInfo = impl.RegistrarInfo{
+		AutoRenew: "yes",
+		State:     state,
+		Expire:    time.Now().AddDate(years, 0, 0).Format(time.DateOnly),
+		TLD:       params.Name[strings.LastIndex(params.Name, ".")+1:],
+	}
+	writeResponse(w, map[string]interface{}{"domain": z.domain})
+}
+
+// registeredZone is like zoneFromRequest but also requires the zone to be
+// registered through GleSYS.
+func (s *Server) registeredZone(w http.ResponseWriter, name string) (*zone, bool) {
+	z, ok := s.zones[name]
+	if !ok || !z.registered() {
+		writeError(w, http.StatusNotFound, "Domain not registered: "+name)
+		return nil, false
+	}
+	return z, true
+}
+
+func (s *Server) handleRenew(w http.ResponseWriter, r *http.Request) {
+	var params impl.RenewDNSDomainParams
+	if !decode(w, r, &params) {
+		return
+	}
+	z, ok := s.registeredZone(w, params.Name)
+	if !ok {
+		return
+	}
+	if params.NumYears < 1 {
+		writeError(w, http.StatusBadRequest, "Argument numyears is required")
+		return
+	}
+	expire, err := time.Parse(time.DateOnly, z.domain.RegistrarInfo.Expire)
+	if err != nil {
+		expire = time.Now()
+	}
+	z.domain.RegistrarInfo.Expire = expire.AddDate(params.NumYears, 0, 0).Format(time.DateOnly)
+	writeResponse(w, map[string]interface{}{"domain": z.domain})
+}
+
+func (s *Server) handleSetAutoRenew(w http.ResponseWriter, r *http.Request) {
+	var params impl.SetAutoRenewParams
+	if !decode(w, r, &params) {
+		return
+	}
+	z, ok := s.registeredZone(w, params.Name)
+	if !ok {
+		return
+	}
+	if params.SetAutoRenew != "yes" && params.SetAutoRenew != "no" {
+		writeError(w, http.StatusBadRequest, "Argument setautorenew must be yes or no")
+		return
+	}
+	z.domain.RegistrarInfo.AutoRenew = params.SetAutoRenew
+	writeResponse(w, map[string]interface{}{"domain": z.domain})
+}
+
+func (s *Server) handleGenerateAuthCode(w http.ResponseWriter, r *http.Request) {
+	var params struct {
+		Name string `json:"domainname"`
+	}
+	if !decode(w, r, &params) {
+		return
+	}
+	if _, ok := s.registeredZone(w, params.Name); !ok {
+		return
+	}
+	writeResponse(w, map[string]interface{}{"authcode": "glesystest-" + params.Name})
+}
+
+// editDomain sets the SOA values given in params, zero values are ignored.
+func editDomain(d *impl.DNSDomain, params impl.EditDNSDomainParams) {
+	if params.PrimaryNameServer != "" {
+		d.PrimaryNameServer = params.PrimaryNameServer
+	}
+	if params.ResponsiblePerson != "" {
+		d.ResponsiblePerson = params.ResponsiblePerson
+	}
+	if params.TTL != 0 {
+		d.TTL = params.TTL
+	}
+	if params.Refresh != 0 {
+		d.Refresh = params.Refresh
+	}
+	if params.Retry != 0 {
+		d.Retry = params.Retry
+	}
+	if params.Expire != 0 {
+		d.Expire = params.Expire
+	}
+	if params.Minimum != 0 {
+		d.Minimum = params.Minimum
+	}
+}
+
+func (s *Server) handleDetails(w http.ResponseWriter, r *http.Request) {
+	z, ok := s.zoneFromRequest(w, r)
+	if !ok {
+		return
+	}
+	d := z.domain
+	d.RecordCount = len(z.records)
+	writeResponse(w, map[string]interface{}{"domain": d})
+}
+
+func (s *Server) handleExport(w http.ResponseWriter, r *http.Request) {
+	z, ok := s.zoneFromRequest(w, r)
+	if !ok {
+		return
+	}
+	d := z.domain
+	sb := &strings.Builder{}
+	fmt.Fprintf(sb, "$ORIGIN %s.\n$TTL %d\n", d.Name, d.TTL)
+	fmt.Fprintf(sb, "@ IN SOA %s %s (%s %d %d %d %d)\n",
+		d.PrimaryNameServer, d.ResponsiblePerson, time.Now().Format("2006010201"),
+		d.Refresh, d.Retry, d.Expire, d.Minimum)
+	for _, dr := range z.records {
+		data := dr.Data
+		if dr.Type == "TXT" {
+			data = fmt.Sprintf("%q", data)
+		}
+		fmt.Fprintf(sb, "%s %d IN %s %s\n", dr.Host, dr.TTL, dr.Type, data)
+	}
+	writeResponse(w, map[string]interface{}{"zonefile": sb.String()})
+}
+
+func (s *Server) handleListRecords(w http.ResponseWriter, r *http.Request) {
+	z, ok := s.zoneFromRequest(w, r)
+	if !ok {
+		return
+	}
+	records := append([]impl.DNSDomainRecord{}, z.records...)
+	writeResponse(w, map[string]interface{}{"records": records})
+}
+
+func (s *Server) handleAddRecord(w http.ResponseWriter, r *http.Request) {
+	var params impl.AddRecordParams
+	if !decode(w, r, &params) {
+		return
+	}
+	z, ok := s.zones[params.DomainName]
+	if !ok {
+		writeError(w, http.StatusNotFound, "Domain not found: "+params.DomainName)
+		return
+	}
+	if params.Host == "" || params.Type == "" || params.Data == "" {
+		writeError(w, http.StatusBadRequest, "Arguments host, type and data are required")
+		return
+	}
+	if params.TTL == 0 {
+		params.TTL = DefaultTTL
+	}
+	dr := s.addRecord(z, params.Host, strings.ToUpper(params.Type), params.Data, params.TTL)
+	writeResponse(w, map[string]interface{}{"record": dr})
+}
+
+func (s *Server) handleUpdateRecord(w http.ResponseWriter, r *http.Request) {
+	var params impl.UpdateRecordParams
+	if !decode(w, r, &params) {
+		return
+	}
+	z, i := s.findRecord(params.RecordID)
+	if z == nil {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("Record not found: %d", params.RecordID))
+		return
+	}
+	dr := &z.records[i]
+	if params.Host != "" {
+		dr.Host = params.Host
+	}
+	if params.Type != "" {
+		dr.Type = strings.ToUpper(params.Type)
+	}
+	if params.Data != "" {
+		dr.Data = params.Data
+	}
+	if params.TTL != nil {
+		dr.TTL = *params.TTL
+	}
+	writeResponse(w, map[string]interface{}{"record": *dr})
+}
+
+func (s *Server) handleDeleteRecord(w http.ResponseWriter, r *http.Request) {
+	var params struct {
+		RecordID int `json:"recordid"`
+	}
+	if !decode(w, r, &params) {
+		return
+	}
+	z, i := s.findRecord(params.RecordID)
+	if z == nil {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("Record not found: %d", params.RecordID))
+		return
+	}
+	z.records = append(z.records[:i], z.records[i+1:]...)
+	writeResponse(w, map[string]interface{}{})
+}
+
+// zoneFromRequest decodes the domainname parameter and looks up the zone,
+// writing an error response if it does not exist.
+func (s *Server) zoneFromRequest(w http.ResponseWriter, r *http.Request) (*zone, bool) {
+	var params struct {
+		Name string `json:"domainname"`
+	}
+	if !decode(w, r, &params) {
+		return nil, false
+	}
+	z, ok := s.zones[params.Name]
+	if !ok {
+		writeError(w, http.StatusNotFound, "Domain not found: "+params.Name)
+		return nil, false
+	}
+	return z, true
+}
+
+func decode(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed: "+r.Method)
+		return false
+	}
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return false
+	}
+	return true
+}
+
+type status struct {
+	Code      int    `json:"code"`
+	Timestamp string `json:"timestamp"`
+	Text      string `json:"text"`
+}
+
+func writeResponse(w http.ResponseWriter, fields map[string]interface{}) {
+	fields["status"] = status{Code: http.StatusOK, Timestamp: time.Now().Format(time.RFC3339), Text: "OK"}
+	writeJSON(w, http.StatusOK, fields)
+}
+
+func writeError(w http.ResponseWriter, code int, text string) {
+	writeJSON(w, code, map[string]interface{}{
+		"status": status{Code: code, Timestamp: time.Now().Format(time.RFC3339), Text: text},
+	})
+}
+
+func writeJSON(w http.ResponseWriter, code int, fields map[string]interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]interface{}{"response": fields})
+}
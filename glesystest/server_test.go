@@ -0,0 +1,89 @@
+// SPDX-FileCopyrightText: 2024 Peter Magnusson <me@kmpm.se>
+// SPDX-License-Identifier: MIT
+
+package glesystest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/libdns/glesys/internal/impl"
+	"github.com/libdns/libdns"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServerRecords(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	s.AddZone("example.com", libdns.RR{Name: "www", Type: "A", Data: "192.0.2.1"})
+	p := s.Provider()
+	ctx := context.Background()
+
+	records, err := p.GetRecords(ctx, "example.com.")
+	assert.NoError(t, err)
+	assert.Len(t, records, 1)
+	assert.Equal(t, DefaultTTL*time.Second, records[0].RR().TTL, "default TTL is applied")
+
+	added, err := p.AppendRecords(ctx, "example.com", []libdns.Record{
+		libdns.TXT{Name: "_acme-challenge", Text: "token", TTL: 5 * time.Minute},
+	})
+	assert.NoError(t, err)
+	assert.Len(t, added, 1)
+	assert.Len(t, s.Records("example.com"), 2)
+
+	deleted, err := p.DeleteRecords(ctx, "example.com", added)
+	assert.NoError(t, err)
+	assert.Len(t, deleted, 1)
+	assert.Equal(t, []Record{{ID: 1000001, Host: "www", Type: "A", Data: "192.0.2.1", TTL: DefaultTTL}}, s.Records("example.com"))
+}
+
+func TestServerErrors(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	s.AddZone("example.com")
+	ctx := context.Background()
+
+	p := s.Provider()
+	p.APIKey = "wrong"
+	_, err := p.GetRecords(ctx, "example.com")
+	assert.ErrorContains(t, err, "401", "bad credentials are rejected")
+
+	p = s.Provider()
+	_, err = p.GetRecords(ctx, "example.org")
+	assert.ErrorContains(t, err, "Domain not found")
+
+	_, err = p.AppendRecords(ctx, "example.com", []libdns.Record{libdns.RR{Name: "www", Type: "A"}})
+	assert.ErrorContains(t, err, "required")
+}
+
+func TestServerListDetailsExport(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	s.AddZone("example.com", libdns.TXT{Name: "@", Text: "hello world", TTL: time.Hour})
+	s.AddZone("example.org")
+	c := impl.NewClient(s.Project, s.APIKey, "test")
+	c.SetBaseURL(s.URL)
+	ctx := context.Background()
+
+	domains, err := c.DNSDomains.List(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, *domains, 2)
+	assert.Equal(t, "example.com", (*domains)[0].Name)
+
+	domain, err := c.DNSDomains.Details(ctx, "example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, domain.RecordCount)
+	assert.Equal(t, "ns1.namesystem.se.", domain.PrimaryNameServer)
+
+	zonefile, err := c.DNSDomains.Export(ctx, "example.com")
+	assert.NoError(t, err)
+	assert.Contains(t, zonefile, `@ 3600 IN TXT "hello world"`)
+
+	ttl := 600
+	record, err := c.DNSDomains.UpdateRecord(ctx, impl.UpdateRecordParams{RecordID: 1000001, TTL: &ttl})
+	assert.NoError(t, err)
+	assert.Equal(t, "hello world", record.Data, "unset fields are kept")
+	assert.Equal(t, 600, s.Records("example.com")[0].TTL, "record was updated")
+	assert.Nil(t, s.Records("example.net"))
+}
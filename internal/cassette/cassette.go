@@ -0,0 +1,210 @@
+// SPDX-FileCopyrightText: 2024 Peter Magnusson <me@kmpm.se>
+// SPDX-License-Identifier: MIT
+
+// Package cassette implements an http.RoundTripper that records GleSYS API
+// interactions to a file and replays them deterministically.
+package cassette
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Mode selects if a Recorder records or replays interactions.
+type Mode int
+
+const (
+	// ModeReplay serves responses from the cassette file without using the network.
+	ModeReplay Mode = iota
+	// ModeRecord sends requests to the real API and saves the interactions.
+	ModeRecord
+)
+
+// Request is the recorded part of a request.
+// Headers, including the credentials, are never recorded.
+type Request struct {
+	Method string          `json:"method"`
+	Path   string          `json:"path"`
+	Body   json.RawMessage `json:"body,omitempty"`
+}
+
+// Response is the recorded part of a response.
+type Response struct {
+	StatusCode int             `json:"status_code"`
+	Body       json.RawMessage `json:"body,omitempty"`
+}
+
+// Interaction is a single request with its response.
+type Interaction struct {
+	Request  Request  `json:"request"`
+	Response Response `json:"response"`
+}
+
+// Cassette is the file format for recorded interactions.
+type Cassette struct {
+	Interactions []Interaction `json:"interactions"`
+}
+
+// Recorder is an http.RoundTripper recording or replaying a Cassette.
+type Recorder struct {
+	mutex     sync.Mutex
+	mode      Mode
+	path      string
+	cassette  Cassette
+	used      []bool
+	scrubs    []string
+	Transport http.RoundTripper
+}
+
+// New creates a Recorder for the cassette file at path.
+// In ModeReplay the file must exist.
+func New(path string, mode Mode) (*Recorder, error) {
+	r := &Recorder{mode: mode, path: path, Transport: http.DefaultTransport}
+	if mode == ModeReplay {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load cassette: %w", err)
+		}
+		if err := json.Unmarshal(b, &r.cassette); err != nil {
+			return nil, fmt.Errorf("failed to parse cassette %s: %w", path, err)
+		}
+		r.used = make([]bool, len(r.cassette.Interactions))
+	}
+	return r, nil
+}
+
+// Scrub replaces every occurence of secret with replacement in recorded
+// request paths and bodies and response bodies. Use it to hide real zone
+// names and other sensitive values from the cassette.
+func (r *Recorder) Scrub(secret, replacement string) {
+	if secret == "" {
+		return
+	}
+	r.scrubs = append(r.scrubs, secret, replacement)
+}
+
+// Client returns an http.Client using the Recorder as transport.
+func (r *Recorder) Client() *http.Client {
+	return &http.Client{Transport: r}
+}
+
+// RoundTrip implements http.RoundTripper.
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	recorded := Request{
+		Method: req.Method,
+		Path:   r.scrub(strings.TrimPrefix(req.URL.Path, "/")),
+		Body:   compact([]byte(r.scrub(string(body)))),
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.mode == ModeReplay {
+		return r.replay(req, recorded)
+	}
+	return r.record(req, recorded)
+}
+
+func (r *Recorder) replay(req *http.Request, recorded Request) (*http.Response, error) {
+	for i, in := range r.cassette.Interactions {
+		if r.used[i] || !in.Request.matches(recorded) {
+			continue
+		}
+		r.used[i] = true
+		return &http.Response{
+			Status:     http.StatusText(in.Response.StatusCode),
+			StatusCode: in.Response.StatusCode,
+			Header:     http.Header{"Content-Type": []string{"application/json"}},
+			Body:       io.NopCloser(bytes.NewReader(in.Response.Body)),
+			Request:    req,
+		}, nil
+	}
+	return nil, fmt.Errorf("cassette %s has no unused interaction for %s %s %s", r.path, recorded.Method, recorded.Path, recorded.Body)
+}
+
+func (r *Recorder) record(req *http.Request, recorded Request) (*http.Response, error) {
+	resp, err := r.Transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	r.cassette.Interactions = append(r.cassette.Interactions, Interaction{
+		Request: recorded,
+		Response: Response{
+			StatusCode: resp.StatusCode,
+			Body:       compact([]byte(r.scrub(string(body)))),
+		},
+	})
+	return resp, nil
+}
+
+// Stop saves the cassette in ModeRecord. In ModeReplay it returns an
+// error if any recorded interaction was never replayed.
+func (r *Recorder) Stop() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.mode == ModeReplay {
+		for i, used := range r.used {
+			if !used {
+				in := r.cassette.Interactions[i].Request
+				return fmt.Errorf("cassette %s interaction %d (%s %s) was never replayed", r.path, i, in.Method, in.Path)
+			}
+		}
+		return nil
+	}
+	b, err := json.MarshalIndent(r.cassette, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(r.path), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(r.path, append(b, '\n'), 0o644)
+}
+
+func (r *Recorder) scrub(s string) string {
+	if len(r.scrubs) == 0 {
+		return s
+	}
+	return strings.NewReplacer(r.scrubs...).Replace(s)
+}
+
+func (q Request) matches(other Request) bool {
+	return q.Method == other.Method && q.Path == other.Path && bytes.Equal(compact(q.Body), compact(other.Body))
+}
+
+// compact removes insignificant whitespace from JSON so bodies can be
+// compared. Anything that is not valid JSON is returned as a JSON string.
+func compact(b []byte) json.RawMessage {
+	b = bytes.TrimSpace(b)
+	if len(b) == 0 {
+		return nil
+	}
+	buf := new(bytes.Buffer)
+	if err := json.Compact(buf, b); err != nil {
+		s, _ := json.Marshal(string(b))
+		return s
+	}
+	return buf.Bytes()
+}
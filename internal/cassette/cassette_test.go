@@ -0,0 +1,77 @@
+// SPDX-FileCopyrightText: 2024 Peter Magnusson <me@kmpm.se>
+// SPDX-License-Identifier: MIT
+
+package cassette
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func post(t *testing.T, c *http.Client, url, body string) (int, string) {
+	t.Helper()
+	req, _ := http.NewRequest("POST", url, strings.NewReader(body))
+	req.SetBasicAuth("cl12345", "supersecret")
+	resp, err := c.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	b, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, string(b)
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		w.Write([]byte(`{"response": {"echo": ` + string(b) + `}}`))
+	}))
+	defer server.Close()
+	path := filepath.Join(t.TempDir(), "cassette.json")
+
+	rec, err := New(path, ModeRecord)
+	assert.NoError(t, err)
+	rec.Scrub("real.se", "example.com")
+	status, body := post(t, rec.Client(), server.URL+"/domain/listrecords", `{"domainname": "real.se"}`)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Contains(t, body, "real.se", "live response is not scrubbed")
+	assert.NoError(t, rec.Stop())
+
+	saved, _ := os.ReadFile(path)
+	assert.NotContains(t, string(saved), "real.se", "zone is scrubbed")
+	assert.NotContains(t, string(saved), "supersecret", "credentials are not recorded")
+
+	rep, err := New(path, ModeReplay)
+	assert.NoError(t, err)
+	status, body = post(t, rep.Client(), "http://unused.invalid/domain/listrecords", `{"domainname":"example.com"}`)
+	assert.Equal(t, http.StatusOK, status)
+	assert.JSONEq(t, `{"response": {"echo": {"domainname": "example.com"}}}`, body)
+	assert.NoError(t, rep.Stop())
+}
+
+func TestReplayMismatch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	os.WriteFile(path, []byte(`{"interactions": [
+		{"request": {"method": "POST", "path": "domain/deleterecord", "body": {"recordid": 1}},
+		 "response": {"status_code": 200, "body": {}}}
+	]}`), 0o644)
+
+	rep, err := New(path, ModeReplay)
+	assert.NoError(t, err)
+	req, _ := http.NewRequest("POST", "http://unused.invalid/domain/deleterecord", strings.NewReader(`{"recordid": 2}`))
+	_, err = rep.Client().Do(req)
+	assert.Error(t, err, "unmatched request fails")
+	assert.Error(t, rep.Stop(), "unused interaction is reported")
+}
+
+func TestReplayMissingFile(t *testing.T) {
+	_, err := New(filepath.Join(t.TempDir(), "missing.json"), ModeReplay)
+	assert.Error(t, err)
+}
@@ -27,15 +27,46 @@ type clientInterface interface {
 
 // Client is used to interact with the GleSYS API
 type Client struct {
-	apiKey     string
-	BaseURL    *url.URL
-	httpClient httpClientInterface
-	project    string
-	userAgent  string
+	apiKey      string
+	BaseURL     *url.URL
+	httpClient  httpClientInterface
+	project     string
+	userAgent   string
+	middlewares []Middleware
 
 	DNSDomains *DNSDomainService
 }
 
+// Call describes a single request to the GleSYS API while it passes
+// through the middleware chain.
+type Call struct {
+	// Method is the HTTP method used, GET or POST.
+	Method string
+	// Path is the API endpoint, e.g. "domain/listrecords".
+	Path string
+	// Params is the value that was encoded as the request body, nil for GET.
+	// The body is already encoded into Request so changing Params has no effect.
+	Params interface{}
+	// Request is the outgoing HTTP request. Middleware may modify it,
+	// for example to add headers.
+	Request *http.Request
+	// Response is the HTTP response. It is nil until the request has been sent.
+	Response *http.Response
+	// Result is the value the response body is decoded into. It may be nil.
+	Result interface{}
+	// Attempts is the number of times the call has been sent. Middleware
+	// that retries a call passes it to next again, with a fresh body in
+	// Request, which makes it more than one.
+	Attempts int
+}
+
+// Handler performs a Call and returns the resulting error, if any.
+type Handler func(call *Call) error
+
+// Middleware wraps a Handler. It can inspect or modify the call before
+// passing it on to next, and inspect the response and error afterwards.
+type Middleware func(next Handler) Handler
+
 // NewClient creates a new Client for interacting with the GleSYS API. This is
 // the main entrypoint for API interactions.
 func NewClient(project, apiKey, userAgent string) *Client {
@@ -54,6 +85,11 @@ func NewClient(project, apiKey, userAgent string) *Client {
 	return c
 }
 
+// SetHTTPClient can be used to set a custom http.Client
+func (c *Client) SetHTTPClient(hc *http.Client) {
+	c.httpClient = hc
+}
+
 // SetBaseURL can be used to set a custom BaseURL
 func (c *Client) SetBaseURL(bu string) error {
 	url, err := url.Parse(bu)
@@ -64,20 +100,38 @@ func (c *Client) SetBaseURL(bu string) error {
 	return nil
 }
 
+// Use appends middleware to the chain that wraps every API call.
+// The first middleware registered is the outermost one.
+// Use is not safe to call concurrently with requests.
+func (c *Client) Use(mw ...Middleware) {
+	c.middlewares = append(c.middlewares, mw...)
+}
+
 func (c *Client) get(ctx context.Context, path string, v interface{}) error {
-	request, err := c.newRequest(ctx, "GET", path, nil)
-	if err != nil {
-		return err
-	}
-	return c.do(request, v)
+	return c.call(ctx, "GET", path, v, nil)
 }
 
 func (c *Client) post(ctx context.Context, path string, v interface{}, params interface{}) error {
-	request, err := c.newRequest(ctx, "POST", path, params)
+	return c.call(ctx, "POST", path, v, params)
+}
+
+func (c *Client) call(ctx context.Context, method, path string, v interface{}, params interface{}) error {
+	request, err := c.newRequest(ctx, method, path, params)
 	if err != nil {
 		return err
 	}
-	return c.do(request, v)
+	call := &Call{
+		Method:  method,
+		Path:    path,
+		Params:  params,
+		Request: request,
+		Result:  v,
+	}
+	handler := Handler(c.do)
+	for i := len(c.middlewares) - 1; i >= 0; i-- {
+		handler = c.middlewares[i](handler)
+	}
+	return handler(call)
 }
 
 func (c *Client) newRequest(ctx context.Context, method, path string, params interface{}) (*http.Request, error) {
@@ -113,17 +167,19 @@ func (c *Client) newRequest(ctx context.Context, method, path string, params int
 	return request, nil
 }
 
-func (c *Client) do(request *http.Request, v interface{}) error {
-	response, err := c.httpClient.Do(request)
+func (c *Client) do(call *Call) error {
+	call.Attempts++
+	response, err := c.httpClient.Do(call.Request)
 	if err != nil {
 		return err
 	}
+	call.Response = response
 
 	if response.StatusCode != http.StatusOK {
 		return handleResponseError(response)
 	}
 
-	return parseResponseBody(response, v)
+	return parseResponseBody(response, call.Result)
 }
 
 func handleResponseError(response *http.Response) error {
@@ -144,11 +200,12 @@ func handleResponseError(response *http.Response) error {
 }
 
 func parseResponseBody(response *http.Response, v interface{}) error {
+	defer response.Body.Close()
 	if v == nil {
-		return nil
+		// still make sure the response is valid
+		v = &struct{}{}
 	}
 
-	defer response.Body.Close()
 	body, err := io.ReadAll(response.Body)
 	if err != nil {
 		return err
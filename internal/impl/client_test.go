@@ -0,0 +1,134 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2017 GleSYS Internet Services AB
+package impl
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestClient(t *testing.T, handler http.HandlerFunc) *Client {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	c := NewClient("cl12345", "secret", "test")
+	if err := c.SetBaseURL(server.URL); err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestClientMiddlewareOrder(t *testing.T) {
+	var gotHeader string
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		gotHeader = r.Header.Get("X-Test")
+		w.Write([]byte(`{"response": {"records": [{"recordid": 1, "host": "www"}]}}`))
+	})
+
+	order := []string{}
+	var seen *Call
+	c.Use(func(next Handler) Handler {
+		return func(call *Call) error {
+			order = append(order, "outer")
+			call.Request.Header.Set("X-Test", "hello")
+			err := next(call)
+			seen = call
+			return err
+		}
+	}, func(next Handler) Handler {
+		return func(call *Call) error {
+			order = append(order, "inner")
+			return next(call)
+		}
+	})
+
+	records, err := c.DNSDomains.ListRecords(context.Background(), "example.com")
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"outer", "inner"}, order, "middleware called in registration order")
+	assert.Equal(t, "hello", gotHeader, "header added by middleware is sent")
+	assert.Equal(t, "domain/listrecords", seen.Path, "path is passed to middleware")
+	assert.Equal(t, "POST", seen.Method, "method is passed to middleware")
+	assert.NotNil(t, seen.Params, "params are passed to middleware")
+	assert.Equal(t, http.StatusOK, seen.Response.StatusCode, "response is passed to middleware")
+	assert.Equal(t, 1, len(*records))
+}
+
+func TestClientMiddlewareError(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"response": {"status": {"code": 401, "text": "Unauthorized"}}}`))
+	})
+
+	var seenErr error
+	c.Use(func(next Handler) Handler {
+		return func(call *Call) error {
+			seenErr = next(call)
+			return seenErr
+		}
+	})
+
+	err := c.DNSDomains.DeleteRecord(context.Background(), 1)
+
+	assert.Error(t, err)
+	assert.Equal(t, err, seenErr, "middleware sees the error")
+}
+
+func TestClientMiddlewareShortCircuit(t *testing.T) {
+	called := false
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	})
+
+	injected := errors.New("injected")
+	c.Use(func(next Handler) Handler {
+		return func(call *Call) error {
+			return injected
+		}
+	})
+
+	_, err := c.DNSDomains.AddRecord(context.Background(), AddRecordParams{DomainName: "example.com"})
+
+	assert.ErrorIs(t, err, injected)
+	assert.False(t, called, "request is never sent")
+}
+
+func TestClientMiddlewareRetry(t *testing.T) {
+	bodies := []string{}
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+		if len(bodies) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte(`{"response": {"status": {"code": 503, "text": "Try again"}}}`))
+			return
+		}
+		w.Write([]byte(`{"response": {"records": []}}`))
+	})
+
+	var seen *Call
+	c.Use(func(next Handler) Handler {
+		return func(call *Call) error {
+			err := next(call)
+			if err != nil {
+				call.Request.Body, _ = call.Request.GetBody()
+				err = next(call)
+			}
+			seen = call
+			return err
+		}
+	})
+
+	_, err := c.DNSDomains.ListRecords(context.Background(), "example.com")
+
+	assert.NoError(t, err)
+	assert.Equal(t, 2, seen.Attempts, "every send is counted")
+	assert.Equal(t, 2, len(bodies))
+	assert.Equal(t, bodies[0], bodies[1], "the retry sends the same body")
+}
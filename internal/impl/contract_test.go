@@ -0,0 +1,105 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2017 GleSYS Internet Services AB
+package impl
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type contractRequest struct {
+	Method string          `json:"method"`
+	Path   string          `json:"path"`
+	Body   json.RawMessage `json:"body"`
+}
+
+// TestDnsDomainsContract compares the request sent by every DNSDomainService
+// method with a golden file. The golden files are written by hand from the
+// GleSYS API documentation, with the arguments in the documented order,
+// and compared as JSON. They are never generated from the code under test.
+func TestDnsDomainsContract(t *testing.T) {
+	ctx := context.Background()
+	ttl, zero := 600, 0
+	contact := RegisterDNSDomainParams{
+		Name:         "example.com",
+		Firstname:    "Alice",
+		Lastname:     "Smith",
+		Email:        "alice@example.com",
+		Address:      "Badhusvägen 45",
+		City:         "Falkenberg",
+		ZipCode:      "31132",
+		Country:      "SE",
+		Organization: "Internetz",
+		NationalID:   13337,
+		PhoneNumber:  "+46.123456",
+	}
+	tests := []struct {
+		name string
+		call func(d *DNSDomainService)
+	}{
+		{"available", func(d *DNSDomainService) { d.Available(ctx, "example.com") }},
+		{"add", func(d *DNSDomainService) {
+			d.AddDNSDomain(ctx, AddDNSDomainParams{Name: "example.com", CreateRecords: "no", TTL: 3600})
+		}},
+		{"delete", func(d *DNSDomainService) { d.Delete(ctx, DeleteDNSDomainParams{Name: "example.com"}) }},
+		{"details", func(d *DNSDomainService) { d.Details(ctx, "example.com") }},
+		{"edit", func(d *DNSDomainService) {
+			d.Edit(ctx, EditDNSDomainParams{Name: "example.com", Retry: 2400, ResponsiblePerson: "hostmaster.example.com."})
+		}},
+		{"export", func(d *DNSDomainService) { d.Export(ctx, "example.com") }},
+		{"list", func(d *DNSDomainService) { d.List(ctx) }},
+		{"generateauthcode", func(d *DNSDomainService) { d.GenerateAuthCode(ctx, "example.com") }},
+		{"register", func(d *DNSDomainService) { d.Register(ctx, contact) }},
+		{"renew", func(d *DNSDomainService) { d.Renew(ctx, RenewDNSDomainParams{Name: "example.com", NumYears: 2}) }},
+		{"setautorenew", func(d *DNSDomainService) {
+			d.SetAutoRenew(ctx, SetAutoRenewParams{Name: "example.com", SetAutoRenew: "no"})
+		}},
+		{"transfer", func(d *DNSDomainService) {
+			params := contact
+			params.AuthCode = "s3cr3t"
+			d.Transfer(ctx, params)
+		}},
+		{"listrecords", func(d *DNSDomainService) { d.ListRecords(ctx, "example.com") }},
+		{"addrecord", func(d *DNSDomainService) {
+			d.AddRecord(ctx, AddRecordParams{DomainName: "example.com", Host: "www", Type: "A", Data: "192.0.2.1", TTL: 600})
+		}},
+		{"addrecord_default_ttl", func(d *DNSDomainService) {
+			d.AddRecord(ctx, AddRecordParams{DomainName: "example.com", Host: "www", Type: "A", Data: "192.0.2.1"})
+		}},
+		{"updaterecord", func(d *DNSDomainService) {
+			d.UpdateRecord(ctx, UpdateRecordParams{RecordID: 1234567, Host: "www", Type: "A", Data: "192.0.2.2", TTL: &ttl})
+		}},
+		{"updaterecord_zero_ttl", func(d *DNSDomainService) {
+			d.UpdateRecord(ctx, UpdateRecordParams{RecordID: 1234567, TTL: &zero})
+		}},
+		{"updaterecord_keep", func(d *DNSDomainService) {
+			d.UpdateRecord(ctx, UpdateRecordParams{RecordID: 1234567, Data: "192.0.2.2"})
+		}},
+		{"deleterecord", func(d *DNSDomainService) { d.DeleteRecord(ctx, 1234567) }},
+		{"changenameservers", func(d *DNSDomainService) {
+			d.ChangeNameservers(ctx, ChangeNameserverParams{DomainName: "example.com", NS1: "ns1.namesystem.se.", NS2: "ns2.namesystem.se."})
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &mockClient{body: `{}`}
+			tt.call(&DNSDomainService{client: c})
+
+			got, err := json.Marshal(contractRequest{Method: c.lastMethod, Path: c.lastPath, Body: c.lastParams})
+			if err != nil {
+				t.Fatal(err)
+			}
+			golden := filepath.Join("testdata", "golden", tt.name+".json")
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.JSONEq(t, string(want), string(got), "request matches %s", golden)
+		})
+	}
+}
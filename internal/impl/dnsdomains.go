@@ -89,6 +89,8 @@ type RegisterDNSDomainParams struct {
 
 	FaxNumber string `json:"fax,omitempty"`
 	NumYears  int    `json:"numyears,omitempty"`
+	// AuthCode is required when transferring a domain.
+	AuthCode string `json:"authcode,omitempty"`
 }
 
 // DeleteDNSDomainParams - parameters for deleting a domain from the dns system.
@@ -129,22 +131,24 @@ type AddRecordParams struct {
 	TTL        int    `json:"ttl,omitempty"`
 }
 
-// UpdateRecordParams - parameters for updating domain records
+// UpdateRecordParams - parameters for updating domain records.
+// Empty strings and a nil TTL are left out of the request and keep the
+// current value. TTL is a pointer so that a TTL of 0 can be set.
 type UpdateRecordParams struct {
 	RecordID int    `json:"recordid"`
 	Data     string `json:"data,omitempty"`
 	Host     string `json:"host,omitempty"`
 	Type     string `json:"type,omitempty"`
-	TTL      int    `json:"ttl,omitempty"`
+	TTL      *int   `json:"ttl,omitempty"`
 }
 
 // ChangeNameserverParams - parameters for updating the nameservers for domain
 type ChangeNameserverParams struct {
 	DomainName string `json:"domainname"`
-	NS1        string `json:"NS1"`
-	NS2        string `json:"NS2"`
-	NS3        string `json:"NS3,omitempty"`
-	NS4        string `json:"NS4,omitempty"`
+	NS1        string `json:"ns1"`
+	NS2        string `json:"ns2"`
+	NS3        string `json:"ns3,omitempty"`
+	NS4        string `json:"ns4,omitempty"`
 }
 
 // Available - checks if the domain is available
@@ -154,7 +158,10 @@ func (s *DNSDomainService) Available(context context.Context, search string) (*[
 			Domain []DNSDomain
 		}
 	}{}
-	err := s.client.post(context, "domain/available", &data, search)
+	params := struct {
+		Search string `json:"search"`
+	}{search}
+	err := s.client.post(context, "domain/available", &data, params)
 	return &data.Response.Domain, err
 }
 
@@ -281,17 +288,25 @@ func (s *DNSDomainService) Transfer(context context.Context, params RegisterDNSD
 
 // ListRecords - return a list of all records for domain
 func (s *DNSDomainService) ListRecords(context context.Context, domainname string) (*[]DNSDomainRecord, error) {
-	data := struct {
-		Response struct {
-			Records []DNSDomainRecord
-		}
-	}{}
-	err := s.client.post(context, "domain/listrecords", &data, struct {
-		Name string `json:"domainname"`
-	}{domainname})
+	data := ListRecordsResult{}
+	err := s.client.post(context, "domain/listrecords", &data, ListRecordsParams{Name: domainname})
 	return &data.Response.Records, err
 }
 
+// ListRecordsParams is the request body of domain/listrecords. Middleware
+// finds it in Call.Params.
+type ListRecordsParams struct {
+	Name string `json:"domainname"`
+}
+
+// ListRecordsResult is the response of domain/listrecords. Middleware
+// finds a pointer to it in Call.Result.
+type ListRecordsResult struct {
+	Response struct {
+		Records []DNSDomainRecord
+	}
+}
+
 // AddRecord - add a domain record
 func (s *DNSDomainService) AddRecord(context context.Context, params AddRecordParams) (*DNSDomainRecord, error) {
 	data := struct {
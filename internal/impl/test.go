@@ -11,16 +11,23 @@ type mockClient struct {
 	body       string
 	lastPath   string
 	lastMethod string
+	lastParams []byte // params as serialized in the request body, nil for GET
 }
 
 func (c *mockClient) get(ctx context.Context, path string, v interface{}) error {
 	c.lastPath = path
 	c.lastMethod = "GET"
+	c.lastParams = nil
 	return json.Unmarshal([]byte(c.body), v)
 }
 
 func (c *mockClient) post(ctx context.Context, path string, v interface{}, params interface{}) error {
 	c.lastPath = path
 	c.lastMethod = "POST"
+	body, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	c.lastParams = body
 	return json.Unmarshal([]byte(c.body), v)
 }
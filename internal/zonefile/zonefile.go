@@ -0,0 +1,38 @@
+// SPDX-FileCopyrightText: 2024 Peter Magnusson <me@kmpm.se>
+// SPDX-License-Identifier: MIT
+
+// Package zonefile holds helpers for the zone file presentation format
+// shared by the provider and the command line tools.
+package zonefile
+
+import (
+	"strconv"
+	"strings"
+)
+
+// UnescapeTXT removes the zone file escapes, \X and \DDD, that
+// miekg/dns keeps in TXT strings.
+func UnescapeTXT(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	sb := &strings.Builder{}
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] != '\\' || i+1 == len(s):
+			sb.WriteByte(s[i])
+		case i+3 < len(s) && isDigits(s[i+1:i+4]):
+			n, _ := strconv.Atoi(s[i+1 : i+4])
+			sb.WriteByte(byte(n))
+			i += 3
+		default:
+			sb.WriteByte(s[i+1])
+			i++
+		}
+	}
+	return sb.String()
+}
+
+func isDigits(s string) bool {
+	return strings.Trim(s, "0123456789") == ""
+}
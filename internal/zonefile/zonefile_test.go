@@ -0,0 +1,30 @@
+// SPDX-FileCopyrightText: 2024 Peter Magnusson <me@kmpm.se>
+// SPDX-License-Identifier: MIT
+
+package zonefile
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnescapeTXT(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"plain", "v=spf1 -all", "v=spf1 -all"},
+		{"quote", `say \"hi\"`, `say "hi"`},
+		{"backslash", `a\\b`, `a\b`},
+		{"decimal", `a\059b`, "a;b"},
+		{"short_decimal", `a\05`, "a05"},
+		{"trailing_backslash", `a\`, `a\`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, UnescapeTXT(tt.in))
+		})
+	}
+}
@@ -0,0 +1,148 @@
+// SPDX-FileCopyrightText: 2024 Peter Magnusson <me@kmpm.se>
+// SPDX-License-Identifier: MIT
+
+package glesys
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/libdns/glesys/internal/impl"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Metrics collects Prometheus metrics about GleSYS API usage.
+// Register it on a prometheus.Registerer and add Metrics.Middleware
+// to a Provider with Provider.Use.
+//
+// Calls sent again by a retry middleware are counted as retries, wherever
+// that middleware is in the chain. The rate-limit gauge is the
+// X-RateLimit-Remaining header of the last response that had one.
+type Metrics struct {
+	calls     *prometheus.CounterVec
+	retries   *prometheus.CounterVec
+	duration  *prometheus.HistogramVec
+	records   *prometheus.GaugeVec
+	rateLimit prometheus.Gauge
+}
+
+// rateLimitHeader holds the number of calls left before GleSYS rate limits
+// the project.
+const rateLimitHeader = "X-RateLimit-Remaining"
+
+// NewMetrics creates a new, unregistered, Metrics collector.
+func NewMetrics() *Metrics {
+	return &Metrics{
+		calls: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "glesys",
+			Subsystem: "api",
+			Name:      "calls_total",
+			Help:      "Number of GleSYS API calls by endpoint and HTTP status. Status is \"error\" if no response was received.",
+		}, []string{"endpoint", "status"}),
+		retries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "glesys",
+			Subsystem: "api",
+			Name:      "retries_total",
+			Help:      "Number of GleSYS API calls sent again after an earlier attempt, by endpoint.",
+		}, []string{"endpoint"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "glesys",
+			Subsystem: "api",
+			Name:      "call_duration_seconds",
+			Help:      "Latency of GleSYS API calls by endpoint.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"endpoint"}),
+		records: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: "glesys",
+			Subsystem: "zone",
+			Name:      "records",
+			Help:      "Number of records in the zone as of the last domain/listrecords call.",
+		}, []string{"zone"}),
+		rateLimit: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: "glesys",
+			Subsystem: "api",
+			Name:      "rate_limit_remaining",
+			Help:      "Number of GleSYS API calls left before rate limiting, as of the last response that reported it.",
+		}),
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (m *Metrics) Describe(ch chan<- *prometheus.Desc) {
+	m.calls.Describe(ch)
+	m.retries.Describe(ch)
+	m.duration.Describe(ch)
+	m.records.Describe(ch)
+	m.rateLimit.Describe(ch)
+}
+
+// Collect implements prometheus.Collector.
+func (m *Metrics) Collect(ch chan<- prometheus.Metric) {
+	m.calls.Collect(ch)
+	m.retries.Collect(ch)
+	m.duration.Collect(ch)
+	m.records.Collect(ch)
+	m.rateLimit.Collect(ch)
+}
+
+// Register registers the collector on reg.
+func (m *Metrics) Register(reg prometheus.Registerer) error {
+	return reg.Register(m)
+}
+
+// Middleware records metrics for every GleSYS API call passing through it.
+func (m *Metrics) Middleware(next Handler) Handler {
+	return func(call *Call) error {
+		start := time.Now()
+		attempts := call.Attempts
+		err := next(call)
+		m.duration.WithLabelValues(call.Path).Observe(time.Since(start).Seconds())
+
+		// a retry middleware before this one passes the call here again, one
+		// after it sends the call several times within next
+		resent := call.Attempts - attempts
+		if attempts == 0 {
+			resent--
+		}
+		if resent > 0 {
+			m.retries.WithLabelValues(call.Path).Add(float64(resent))
+		}
+
+		status := "error"
+		if call.Response != nil {
+			status = strconv.Itoa(call.Response.StatusCode)
+			m.observeRateLimit(call.Response)
+		}
+		m.calls.WithLabelValues(call.Path, status).Inc()
+
+		if err == nil && call.Path == "domain/listrecords" {
+			m.observeRecords(call)
+		}
+		return err
+	}
+}
+
+// observeRecords updates the record gauge from a domain/listrecords call.
+func (m *Metrics) observeRecords(call *Call) {
+	params, ok := call.Params.(impl.ListRecordsParams)
+	if !ok {
+		return
+	}
+	if result, ok := call.Result.(*impl.ListRecordsResult); ok {
+		m.records.WithLabelValues(params.Name).Set(float64(len(result.Response.Records)))
+	}
+}
+
+// observeRateLimit updates the rate-limit gauge from the headers of a
+// response, if it has them.
+func (m *Metrics) observeRateLimit(response *http.Response) {
+	remaining, err := strconv.Atoi(response.Header.Get(rateLimitHeader))
+	if err != nil {
+		return
+	}
+	m.rateLimit.Set(float64(remaining))
+}
+
+// Interface guards
+var _ prometheus.Collector = (*Metrics)(nil)
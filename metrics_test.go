@@ -0,0 +1,104 @@
+// SPDX-FileCopyrightText: 2024 Peter Magnusson <me@kmpm.se>
+// SPDX-License-Identifier: MIT
+
+package glesys
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/libdns/libdns"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMetrics(t *testing.T) {
+	p := newTestProvider(t, func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/domain/addrecord") {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"response": {"status": {"code": 400, "text": "Bad request"}}}`))
+			return
+		}
+		w.Write([]byte(listRecordsResponse))
+	})
+	m := NewMetrics()
+	reg := prometheus.NewPedanticRegistry()
+	if err := m.Register(reg); err != nil {
+		t.Fatal(err)
+	}
+	p.Use(m.Middleware)
+
+	p.GetRecords(context.TODO(), "example.com")
+	p.AppendRecords(context.TODO(), "example.com", []libdns.Record{libdns.TXT{Name: "test", Text: "hello"}})
+
+	if got := testutil.ToFloat64(m.calls.WithLabelValues("domain/listrecords", "200")); got != 1 {
+		t.Errorf("Expected 1 successful listrecords call. Got %v", got)
+	}
+	if got := testutil.ToFloat64(m.calls.WithLabelValues("domain/addrecord", "400")); got != 1 {
+		t.Errorf("Expected 1 failed addrecord call. Got %v", got)
+	}
+	if got := testutil.ToFloat64(m.records.WithLabelValues("example.com")); got != 1 {
+		t.Errorf("Expected zone gauge of 1 record. Got %v", got)
+	}
+	if got := testutil.CollectAndCount(m.duration); got != 2 {
+		t.Errorf("Expected latency for 2 endpoints. Got %v", got)
+	}
+}
+
+func TestMetricsRetriesAndRateLimit(t *testing.T) {
+	// retry sends a failed call once more
+	retry := func(next Handler) Handler {
+		return func(call *Call) error {
+			err := next(call)
+			if err != nil && call.Response != nil {
+				call.Request.Body, _ = call.Request.GetBody()
+				err = next(call)
+			}
+			return err
+		}
+	}
+	tests := []struct {
+		name  string
+		chain func(m *Metrics) []Middleware
+	}{
+		{"retry_before_metrics", func(m *Metrics) []Middleware { return []Middleware{retry, m.Middleware} }},
+		{"retry_after_metrics", func(m *Metrics) []Middleware { return []Middleware{m.Middleware, retry} }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			remaining := 100
+			p := newTestProvider(t, func(w http.ResponseWriter, r *http.Request) {
+				remaining--
+				w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+				if remaining == 99 {
+					w.WriteHeader(http.StatusServiceUnavailable)
+					w.Write([]byte(`{"response": {"status": {"code": 503, "text": "Try again"}}}`))
+					return
+				}
+				w.Write([]byte(listRecordsResponse))
+			})
+			m := NewMetrics()
+			if err := m.Register(prometheus.NewPedanticRegistry()); err != nil {
+				t.Fatal(err)
+			}
+			p.Use(tt.chain(m)...)
+
+			if _, err := p.GetRecords(context.TODO(), "example.com"); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := p.GetRecords(context.TODO(), "example.com"); err != nil {
+				t.Fatal(err)
+			}
+
+			if got := testutil.ToFloat64(m.retries.WithLabelValues("domain/listrecords")); got != 1 {
+				t.Errorf("Expected 1 retry. Got %v", got)
+			}
+			if got := testutil.ToFloat64(m.rateLimit); got != 97 {
+				t.Errorf("Expected 97 calls left. Got %v", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,227 @@
+// SPDX-FileCopyrightText: 2024 Peter Magnusson <me@kmpm.se>
+// SPDX-License-Identifier: MIT
+
+package glesys
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"slices"
+	"strings"
+
+	"github.com/libdns/glesys/internal/impl"
+	"github.com/libdns/libdns"
+	"github.com/miekg/dns"
+)
+
+// Resolver looks up the NS records of a name. CheckDelegation uses it to
+// find the name servers of the parent zone. *net.Resolver satisfies it.
+type Resolver interface {
+	LookupNS(ctx context.Context, name string) ([]*net.NS, error)
+}
+
+// ChangeNameservers changes the name servers a domain registered through
+// GleSYS is delegated to. Two to four name servers must be given. GleSYS
+// cannot read them back; Zone.UsingGlesysNameserver tells if they are
+// those of GleSYS, and CheckDelegation looks up the delegation in DNS.
+func (p *Provider) ChangeNameservers(ctx context.Context, zone string, nameservers ...string) error {
+	ctx, span := p.startSpan(ctx, "ChangeNameservers", zone, nil)
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	err := p.changeNameservers(ctx, zone, nameservers)
+	endSpan(span, nil, err)
+	return err
+}
+
+func (p *Provider) changeNameservers(ctx context.Context, zone string, nameservers []string) error {
+	zone = cleanZ(zone)
+	if debug {
+		log.Printf("ChangeNameservers zone=%s nameservers=%v", zone, nameservers)
+	}
+	if len(nameservers) < 2 || len(nameservers) > 4 {
+		return fmt.Errorf("invalid nameservers: need 2 to 4 name servers, got %d", len(nameservers))
+	}
+	ns := make([]string, 4)
+	for i, n := range nameservers {
+		n = fqdn(n)
+		if n == "." {
+			return fmt.Errorf("invalid nameservers: name server %d is empty", i+1)
+		}
+		if slices.Contains(ns, n) {
+			return fmt.Errorf("invalid nameservers: %s is given twice", n)
+		}
+		ns[i] = n
+	}
+	return p.client().DNSDomains.ChangeNameservers(ctx, impl.ChangeNameserverParams{
+		DomainName: zone,
+		NS1:        ns[0],
+		NS2:        ns[1],
+		NS3:        ns[2],
+		NS4:        ns[3],
+	})
+}
+
+// fqdn returns the lower case, fully qualified form of a host name.
+func fqdn(name string) string {
+	return strings.ToLower(strings.TrimRight(strings.TrimSpace(name), ".")) + "."
+}
+
+// DelegationReport compares the name servers a zone is delegated to with
+// the NS records at the apex of the zone. All names are fully qualified,
+// lower case and sorted.
+type DelegationReport struct {
+	Zone string `json:"zone"`
+
+	// UsingGlesysNameserver is what GleSYS reports about the delegation.
+	UsingGlesysNameserver bool `json:"using_glesys_nameserver"`
+
+	// Delegated are the name servers in the referral from the parent zone.
+	Delegated []string `json:"delegated"`
+	// ZoneNS are the NS records at the apex of the zone in GleSYS.
+	ZoneNS []string `json:"zone_ns"`
+
+	// Missing are the name servers in ZoneNS that are not delegated to.
+	Missing []string `json:"missing,omitempty"`
+	// Unexpected are the delegated name servers not in ZoneNS.
+	Unexpected []string `json:"unexpected,omitempty"`
+}
+
+// OK returns true if the delegation matches the NS records of the zone.
+func (r *DelegationReport) OK() bool {
+	return len(r.Delegated) > 0 && len(r.Missing) == 0 && len(r.Unexpected) == 0
+}
+
+// CheckDelegation asks the name servers of the parent zone which name
+// servers the zone is delegated to, and compares them with the NS records
+// at the apex of the zone. The parent zone and its name servers are found
+// with resolver, nil means net.DefaultResolver. The parent name servers
+// are queried directly through DNSExchanger. Mismatches are reported, not
+// returned as errors.
+func (p *Provider) CheckDelegation(ctx context.Context, zone string, resolver Resolver) (*DelegationReport, error) {
+	ctx, span := p.startSpan(ctx, "CheckDelegation", zone, nil)
+	report, err := p.checkDelegation(ctx, zone, resolver)
+	endSpan(span, nil, err)
+	return report, err
+}
+
+func (p *Provider) checkDelegation(ctx context.Context, zone string, resolver Resolver) (*DelegationReport, error) {
+	zone = cleanZ(zone)
+	if debug {
+		log.Printf("CheckDelegation zone=%s", zone)
+	}
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	// only the API calls hold the lock, the DNS queries must not block others
+	p.mutex.Lock()
+	details, err := p.zoneDetails(ctx, zone)
+	var records []libdns.Record
+	if err == nil {
+		records, err = p.getRecords(ctx, zone)
+	}
+	p.mutex.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	report := &DelegationReport{
+		Zone:                  zone,
+		UsingGlesysNameserver: details.UsingGlesysNameserver,
+		Delegated:             []string{},
+		ZoneNS:                []string{},
+	}
+	for _, r := range records {
+		if ns, ok := r.(libdns.NS); ok && ns.Name == "@" {
+			report.ZoneNS = append(report.ZoneNS, fqdn(libdns.AbsoluteName(ns.Target, zone+".")))
+		}
+	}
+	delegated, err := p.delegation(ctx, zone, resolver)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up name servers of %s: %w", zone, err)
+	}
+	report.Delegated = delegated
+	slices.Sort(report.ZoneNS)
+	slices.Sort(report.Delegated)
+	report.ZoneNS = slices.Compact(report.ZoneNS)
+	report.Delegated = slices.Compact(report.Delegated)
+	for _, ns := range report.ZoneNS {
+		if !slices.Contains(report.Delegated, ns) {
+			report.Missing = append(report.Missing, ns)
+		}
+	}
+	for _, ns := range report.Delegated {
+		if !slices.Contains(report.ZoneNS, ns) {
+			report.Unexpected = append(report.Unexpected, ns)
+		}
+	}
+	return report, nil
+}
+
+// delegation returns the name servers in the referral for zone from the
+// name servers of its parent zone. The recursive resolver is only used to
+// find the parent, as it answers with the NS records of the zone itself.
+func (p *Provider) delegation(ctx context.Context, zone string, resolver Resolver) ([]string, error) {
+	parent, servers, err := parentNameservers(ctx, zone, resolver)
+	if err != nil {
+		return nil, err
+	}
+	m := new(dns.Msg)
+	m.SetQuestion(zone+".", dns.TypeNS)
+	m.RecursionDesired = false
+	errs := []error{}
+	for _, server := range servers {
+		resp, err := p.exchange(ctx, m, server)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", server, err))
+			continue
+		}
+		if resp.Rcode != dns.RcodeSuccess {
+			errs = append(errs, fmt.Errorf("%s: %s", server, dns.RcodeToString[resp.Rcode]))
+			continue
+		}
+		// a referral has the NS records in the authority section, a parent
+		// that also serves the zone answers with them
+		delegated := []string{}
+		for _, rr := range append(resp.Answer, resp.Ns...) {
+			if ns, ok := rr.(*dns.NS); ok && strings.EqualFold(ns.Hdr.Name, zone+".") {
+				delegated = append(delegated, fqdn(ns.Ns))
+			}
+		}
+		if len(delegated) == 0 {
+			return nil, fmt.Errorf("%s is not delegated from %s", zone, parent)
+		}
+		return delegated, nil
+	}
+	return nil, errors.Join(errs...)
+}
+
+// parentNameservers returns the closest enclosing zone of zone that has
+// name servers, and those name servers.
+func parentNameservers(ctx context.Context, zone string, resolver Resolver) (string, []string, error) {
+	name := zone + "."
+	for name != "." {
+		_, name, _ = strings.Cut(name, ".")
+		if name == "" {
+			name = "."
+		}
+		records, err := resolver.LookupNS(ctx, name)
+		var dnsErr *net.DNSError
+		if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+			continue
+		}
+		if err != nil {
+			return "", nil, err
+		}
+		servers := make([]string, 0, len(records))
+		for _, ns := range records {
+			servers = append(servers, fqdn(ns.Host))
+		}
+		if len(servers) > 0 {
+			slices.Sort(servers)
+			return name, servers, nil
+		}
+	}
+	return "", nil, fmt.Errorf("no parent zone of %s found", zone)
+}
@@ -0,0 +1,280 @@
+// SPDX-FileCopyrightText: 2024 Peter Magnusson <me@kmpm.se>
+// SPDX-License-Identifier: MIT
+
+package glesys_test
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/libdns/glesys"
+	"github.com/libdns/glesys/glesystest"
+	"github.com/libdns/libdns"
+	"github.com/miekg/dns"
+)
+
+func TestProvider_ChangeNameservers(t *testing.T) {
+	tests := []struct {
+		name        string
+		nameservers []string
+		want        []string
+		wantGlesys  bool
+		wantErr     string
+	}{
+		{"glesys", []string{"ns1.namesystem.se", "NS2.namesystem.se.", "ns3.namesystem.se."},
+			[]string{"ns1.namesystem.se.", "ns2.namesystem.se.", "ns3.namesystem.se."}, true, ""},
+		{"external", []string{"ns1.example.net.", "ns2.example.net."},
+			[]string{"ns1.example.net.", "ns2.example.net."}, false, ""},
+		{"too_few", []string{"ns1.example.net."}, nil, true, "need 2 to 4"},
+		{"too_many", []string{"a.", "b.", "c.", "d.", "e."}, nil, true, "need 2 to 4"},
+		{"empty", []string{"ns1.example.net.", " "}, nil, true, "name server 2 is empty"},
+		{"duplicate", []string{"ns1.example.net.", "NS1.example.net"}, nil, true, "given twice"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := glesystest.NewServer()
+			defer s.Close()
+			s.AddZone("example.com")
+			p := s.Provider()
+			ctx := context.Background()
+
+			err := p.ChangeNameservers(ctx, "example.com.", tt.nameservers...)
+
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("ChangeNameservers() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ChangeNameservers() error = %v", err)
+			}
+			if got := s.Nameservers("example.com"); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Nameservers are %v, want %v", got, tt.want)
+			}
+			z, err := p.ZoneDetails(ctx, "example.com")
+			if err != nil {
+				t.Fatalf("ZoneDetails() error = %v", err)
+			}
+			if z.UsingGlesysNameserver != tt.wantGlesys {
+				t.Errorf("UsingGlesysNameserver = %v, want %v", z.UsingGlesysNameserver, tt.wantGlesys)
+			}
+		})
+	}
+}
+
+// newTestResolver starts a DNS server answering NS queries from ns and
+// returns a resolver that sends all queries to it.
+func newTestResolver(t *testing.T, ns map[string][]string) *net.Resolver {
+	t.Helper()
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &dns.Server{PacketConn: pc, Handler: dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetReply(req)
+		q := req.Question[0]
+		hosts, ok := ns[strings.ToLower(q.Name)]
+		if !ok {
+			m.Rcode = dns.RcodeNameError
+		}
+		if q.Qtype == dns.TypeNS {
+			for _, host := range hosts {
+				m.Answer = append(m.Answer, &dns.NS{
+					Hdr: dns.RR_Header{Name: q.Name, Rrtype: dns.TypeNS, Class: dns.ClassINET, Ttl: 300},
+					Ns:  host,
+				})
+			}
+		}
+		w.WriteMsg(m)
+	})}
+	started := make(chan struct{})
+	server.NotifyStartedFunc = func() { close(started) }
+	go server.ActivateAndServe()
+	<-started
+	t.Cleanup(func() { server.Shutdown() })
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "udp", pc.LocalAddr().String())
+		},
+	}
+}
+
+// newTestParent starts a DNS server for a parent zone that answers NS
+// queries for the zones in delegations with a referral.
+func newTestParent(t *testing.T, delegations map[string][]string) string {
+	t.Helper()
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &dns.Server{PacketConn: pc, Handler: dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetReply(req)
+		q := req.Question[0]
+		hosts, ok := delegations[strings.ToLower(q.Name)]
+		if !ok || req.RecursionDesired {
+			m.Rcode = dns.RcodeNameError
+		}
+		for _, host := range hosts {
+			m.Ns = append(m.Ns, &dns.NS{
+				Hdr: dns.RR_Header{Name: q.Name, Rrtype: dns.TypeNS, Class: dns.ClassINET, Ttl: 300},
+				Ns:  host,
+			})
+		}
+		w.WriteMsg(m)
+	})}
+	started := make(chan struct{})
+	server.NotifyStartedFunc = func() { close(started) }
+	go server.ActivateAndServe()
+	<-started
+	t.Cleanup(func() { server.Shutdown() })
+	return pc.LocalAddr().String()
+}
+
+func TestProvider_CheckDelegation(t *testing.T) {
+	zoneNS := []libdns.Record{
+		libdns.NS{Name: "@", TTL: time.Hour, Target: "ns1.namesystem.se."},
+		libdns.NS{Name: "@", TTL: time.Hour, Target: "ns2.namesystem.se."},
+		libdns.NS{Name: "sub", TTL: time.Hour, Target: "ns.example.net."},
+	}
+	tests := []struct {
+		name           string
+		zone           string
+		delegated      []string
+		wantOK         bool
+		wantMissing    []string
+		wantUnexpected []string
+	}{
+		{"match", "example.com", []string{"NS2.namesystem.se.", "ns1.namesystem.se."}, true, nil, nil},
+		{"missing", "example.com", []string{"ns1.namesystem.se."}, false, []string{"ns2.namesystem.se."}, nil},
+		{"unexpected", "example.com", []string{"ns1.namesystem.se.", "ns2.namesystem.se.", "ns.example.net."}, false, nil, []string{"ns.example.net."}},
+		{"parent_above_cut", "www.example.com", []string{"ns1.namesystem.se.", "ns2.namesystem.se."}, true, nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := glesystest.NewServer()
+			defer s.Close()
+			s.AddZone(tt.zone, zoneNS...)
+			// the recursive resolver answers for the zone itself with its
+			// own NS records, which must not be taken as the delegation
+			resolver := newTestResolver(t, map[string][]string{
+				"com.":        {"a.gtld.test.", "b.gtld.test."},
+				tt.zone + ".": {"ns1.namesystem.se.", "ns2.namesystem.se."},
+			})
+			parent := newTestParent(t, map[string][]string{tt.zone + ".": tt.delegated})
+			p := s.Provider()
+			p.DNSExchanger = &redirectExchanger{to: map[string]string{"b.gtld.test": parent}}
+
+			report, err := p.CheckDelegation(context.Background(), tt.zone, resolver)
+
+			if err != nil {
+				t.Fatalf("CheckDelegation() error = %v", err)
+			}
+			if report.OK() != tt.wantOK {
+				t.Errorf("OK() = %v, want %v for %+v", report.OK(), tt.wantOK, report)
+			}
+			if want := []string{"ns1.namesystem.se.", "ns2.namesystem.se."}; !reflect.DeepEqual(report.ZoneNS, want) {
+				t.Errorf("ZoneNS = %v, want %v", report.ZoneNS, want)
+			}
+			if !reflect.DeepEqual(report.Missing, tt.wantMissing) {
+				t.Errorf("Missing = %v, want %v", report.Missing, tt.wantMissing)
+			}
+			if !reflect.DeepEqual(report.Unexpected, tt.wantUnexpected) {
+				t.Errorf("Unexpected = %v, want %v", report.Unexpected, tt.wantUnexpected)
+			}
+			if !report.UsingGlesysNameserver {
+				t.Errorf("UsingGlesysNameserver = false")
+			}
+		})
+	}
+}
+
+func TestProvider_CheckDelegationNotDelegated(t *testing.T) {
+	s := glesystest.NewServer()
+	defer s.Close()
+	s.AddZone("example.com")
+	resolver := newTestResolver(t, map[string][]string{"com.": {"a.gtld.test."}})
+	p := s.Provider()
+	p.DNSExchanger = &redirectExchanger{to: map[string]string{"a.gtld.test": newTestParent(t, nil)}}
+
+	_, err := p.CheckDelegation(context.Background(), "example.com", resolver)
+
+	if err == nil || !strings.Contains(err.Error(), "failed to look up name servers") {
+		t.Errorf("CheckDelegation() error = %v", err)
+	}
+}
+
+func TestProvider_CheckDelegationTruncated(t *testing.T) {
+	s := glesystest.NewServer()
+	defer s.Close()
+	s.AddZone("example.com", libdns.NS{Name: "@", TTL: time.Hour, Target: "ns1.namesystem.se."})
+	resolver := newTestResolver(t, map[string][]string{"com.": {"a.gtld.test."}})
+	parent := newTestParent(t, map[string][]string{"example.com.": {"ns1.namesystem.se."}})
+	p := s.Provider()
+	p.DNSExchanger = &truncatingExchanger{}
+	p.DNSTCPExchanger = &redirectExchanger{to: map[string]string{"a.gtld.test": parent}}
+
+	report, err := p.CheckDelegation(context.Background(), "example.com", resolver)
+
+	if err != nil {
+		t.Fatalf("CheckDelegation() error = %v", err)
+	}
+	if want := []string{"ns1.namesystem.se."}; !report.OK() || !reflect.DeepEqual(report.Delegated, want) {
+		t.Errorf("CheckDelegation() = %+v, want delegated to %v", report, want)
+	}
+}
+
+// blockingExchanger holds every query until release is closed.
+type blockingExchanger struct {
+	started chan struct{}
+	release chan struct{}
+	next    glesys.Exchanger
+}
+
+func (e *blockingExchanger) ExchangeContext(ctx context.Context, m *dns.Msg, address string) (*dns.Msg, time.Duration, error) {
+	select {
+	case e.started <- struct{}{}:
+	default:
+	}
+	<-e.release
+	return e.next.ExchangeContext(ctx, m, address)
+}
+
+func TestProvider_CheckDelegationDoesNotBlock(t *testing.T) {
+	s := glesystest.NewServer()
+	defer s.Close()
+	s.AddZone("example.com", libdns.NS{Name: "@", TTL: time.Hour, Target: "ns1.namesystem.se."})
+	resolver := newTestResolver(t, map[string][]string{"com.": {"a.gtld.test."}})
+	parent := newTestParent(t, map[string][]string{"example.com.": {"ns1.namesystem.se."}})
+	e := &blockingExchanger{
+		started: make(chan struct{}, 1),
+		release: make(chan struct{}),
+		next:    &redirectExchanger{to: map[string]string{"a.gtld.test": parent}},
+	}
+	p := s.Provider()
+	p.DNSExchanger = e
+	ctx := context.Background()
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := p.CheckDelegation(ctx, "example.com", resolver)
+		done <- err
+	}()
+	<-e.started
+	// other calls go through while the parent name server is queried
+	if _, err := p.GetRecords(ctx, "example.com"); err != nil {
+		t.Errorf("GetRecords() error = %v", err)
+	}
+	close(e.release)
+	if err := <-done; err != nil {
+		t.Errorf("CheckDelegation() error = %v", err)
+	}
+}
@@ -0,0 +1,184 @@
+// SPDX-FileCopyrightText: 2024 Peter Magnusson <me@kmpm.se>
+// SPDX-License-Identifier: MIT
+
+package glesys
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/libdns/glesys/internal/zonefile"
+	"github.com/libdns/libdns"
+	"github.com/miekg/dns"
+)
+
+// ErrNotPropagated is returned by WaitForRecords when the name servers do
+// not serve the records before the timeout.
+var ErrNotPropagated = errors.New("records not served by all name servers")
+
+const (
+	defaultPropagationTimeout = 2 * time.Minute
+	defaultPollingInterval    = 2 * time.Second
+)
+
+// Exchanger sends a DNS query to the name server at address, a host and
+// port. *dns.Client satisfies it.
+type Exchanger interface {
+	ExchangeContext(ctx context.Context, m *dns.Msg, address string) (*dns.Msg, time.Duration, error)
+}
+
+// WaitForRecords waits until every authoritative name server of the zone
+// serves the records with the expected data, or the PropagationTimeout of
+// the provider runs out. The name servers are the NS records at the apex
+// of the zone, or the primary name server from the zone details if there
+// are none. They are queried directly through DNSExchanger every
+// PollingInterval. TTLs are not compared.
+func (p *Provider) WaitForRecords(ctx context.Context, zone string, records []libdns.Record) error {
+	ctx, span := p.startSpan(ctx, "WaitForRecords", zone, records)
+	err := p.waitForRecords(ctx, zone, records)
+	endSpan(span, nil, err)
+	return err
+}
+
+func (p *Provider) waitForRecords(ctx context.Context, zone string, records []libdns.Record) error {
+	zone = cleanZ(zone)
+	if debug {
+		log.Printf("WaitForRecords zone=%s records=%d", zone, len(records))
+	}
+	// only the API calls hold the lock, waiting must not block others
+	p.mutex.Lock()
+	nameservers, err := p.authoritativeNameservers(ctx, zone)
+	p.mutex.Unlock()
+	if err != nil {
+		return err
+	}
+
+	timeout := p.PropagationTimeout
+	if timeout <= 0 {
+		timeout = defaultPropagationTimeout
+	}
+	interval := p.PollingInterval
+	if interval <= 0 {
+		interval = defaultPollingInterval
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	// the records each name server does not serve yet
+	pending := map[string][]libdns.Record{}
+	for _, ns := range nameservers {
+		pending[ns] = records
+	}
+	for {
+		for _, ns := range nameservers {
+			if len(pending[ns]) == 0 {
+				continue
+			}
+			pending[ns] = slices.DeleteFunc(slices.Clone(pending[ns]), func(r libdns.Record) bool {
+				return p.serves(ctx, ns, zone, r)
+			})
+		}
+		missing := []string{}
+		for _, ns := range nameservers {
+			for _, r := range pending[ns] {
+				rr := r.RR()
+				missing = append(missing, fmt.Sprintf("%s %s %s at %s", rr.Name, rr.Type, rr.Data, ns))
+			}
+		}
+		if len(missing) == 0 {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%w within %v: %s", ErrNotPropagated, timeout, strings.Join(missing, ", "))
+		case <-ticker.C:
+		}
+	}
+}
+
+// authoritativeNameservers returns the NS records at the apex of the
+// zone, or else the primary name server of the zone.
+func (p *Provider) authoritativeNameservers(ctx context.Context, zone string) ([]string, error) {
+	records, err := p.getRecords(ctx, zone)
+	if err != nil {
+		return nil, err
+	}
+	nameservers := []string{}
+	for _, r := range records {
+		if ns, ok := r.(libdns.NS); ok && ns.Name == "@" {
+			nameservers = append(nameservers, fqdn(libdns.AbsoluteName(ns.Target, zone+".")))
+		}
+	}
+	if len(nameservers) == 0 {
+		details, err := p.zoneDetails(ctx, zone)
+		if err != nil {
+			return nil, err
+		}
+		if details.PrimaryNameServer == "" {
+			return nil, fmt.Errorf("no name servers found for %s", zone)
+		}
+		nameservers = append(nameservers, fqdn(details.PrimaryNameServer))
+	}
+	slices.Sort(nameservers)
+	return slices.Compact(nameservers), nil
+}
+
+// exchange sends m to the name server ns through DNSExchanger. A
+// truncated answer is asked for again through DNSTCPExchanger.
+func (p *Provider) exchange(ctx context.Context, m *dns.Msg, ns string) (*dns.Msg, error) {
+	address := net.JoinHostPort(strings.TrimSuffix(ns, "."), "53")
+	exchanger := p.DNSExchanger
+	if exchanger == nil {
+		exchanger = &dns.Client{}
+	}
+	resp, _, err := exchanger.ExchangeContext(ctx, m, address)
+	if err != nil || !resp.Truncated {
+		return resp, err
+	}
+	exchanger = p.DNSTCPExchanger
+	if exchanger == nil {
+		exchanger = &dns.Client{Net: "tcp"}
+	}
+	resp, _, err = exchanger.ExchangeContext(ctx, m, address)
+	return resp, err
+}
+
+// serves returns true if the name server answers with the record.
+// Errors count as not serving it, the next poll tries again.
+func (p *Provider) serves(ctx context.Context, ns, zone string, r libdns.Record) bool {
+	want := canonicalRR(r)
+	qtype, ok := dns.StringToType[want.Type]
+	if !ok {
+		return false
+	}
+	name := libdns.AbsoluteName(want.Name, zone+".")
+	m := new(dns.Msg)
+	m.SetQuestion(dns.Fqdn(name), qtype)
+	m.RecursionDesired = false
+	resp, err := p.exchange(ctx, m, ns)
+	if err != nil || resp.Rcode != dns.RcodeSuccess {
+		return false
+	}
+	for _, answer := range resp.Answer {
+		hdr := answer.Header()
+		if hdr.Rrtype != qtype || !strings.EqualFold(hdr.Name, dns.Fqdn(name)) {
+			continue
+		}
+		got := libdns.RR{Name: want.Name, Type: want.Type, Data: strings.TrimPrefix(answer.String(), hdr.String())}
+		if txt, ok := answer.(*dns.TXT); ok {
+			got.Data = zonefile.UnescapeTXT(strings.Join(txt.Txt, ""))
+		}
+		if canonicalRR(got).Data == want.Data {
+			return true
+		}
+	}
+	return false
+}
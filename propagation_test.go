@@ -0,0 +1,211 @@
+// SPDX-FileCopyrightText: 2024 Peter Magnusson <me@kmpm.se>
+// SPDX-License-Identifier: MIT
+
+package glesys_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/libdns/glesys"
+	"github.com/libdns/glesys/glesystest"
+	"github.com/libdns/libdns"
+	"github.com/miekg/dns"
+)
+
+// newTestNameserver starts a DNS server answering from the records of a
+// zone in s, but only after it has answered lag queries, like a name
+// server that has not caught up yet. A negative lag never catches up.
+func newTestNameserver(t *testing.T, s *glesystest.Server, zone string, lag int64) (string, *atomic.Int64) {
+	t.Helper()
+	queries := &atomic.Int64{}
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &dns.Server{PacketConn: pc, Handler: dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetReply(req)
+		m.Authoritative = true
+		if n := queries.Add(1); lag >= 0 && n > lag {
+			q := req.Question[0]
+			for _, r := range s.Records(zone) {
+				name := libdns.AbsoluteName(r.Host, zone+".")
+				if !strings.EqualFold(name, q.Name) || dns.StringToType[r.Type] != q.Qtype {
+					continue
+				}
+				data := r.Data
+				if r.Type == "TXT" {
+					data = `"` + strings.ReplaceAll(data, `"`, `\"`) + `"`
+				}
+				rr, err := dns.NewRR(name + " 60 IN " + r.Type + " " + data)
+				if err != nil {
+					t.Error(err)
+					continue
+				}
+				m.Answer = append(m.Answer, rr)
+			}
+		}
+		w.WriteMsg(m)
+	})}
+	started := make(chan struct{})
+	server.NotifyStartedFunc = func() { close(started) }
+	go server.ActivateAndServe()
+	<-started
+	t.Cleanup(func() { server.Shutdown() })
+	return pc.LocalAddr().String(), queries
+}
+
+// redirectExchanger sends the queries for each name server to a local
+// test name server.
+type redirectExchanger struct {
+	client dns.Client
+	to     map[string]string
+}
+
+func (e *redirectExchanger) ExchangeContext(ctx context.Context, m *dns.Msg, address string) (*dns.Msg, time.Duration, error) {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, 0, err
+	}
+	to, ok := e.to[host]
+	if !ok {
+		return nil, 0, errors.New("no test name server for " + host)
+	}
+	return e.client.ExchangeContext(ctx, m, to)
+}
+
+// truncatingExchanger answers every query with an empty, truncated
+// answer, like a name server whose answer does not fit in UDP.
+type truncatingExchanger struct {
+	queries atomic.Int64
+}
+
+func (e *truncatingExchanger) ExchangeContext(ctx context.Context, m *dns.Msg, address string) (*dns.Msg, time.Duration, error) {
+	e.queries.Add(1)
+	resp := new(dns.Msg)
+	resp.SetReply(m)
+	resp.Truncated = true
+	return resp, 0, nil
+}
+
+func TestProvider_WaitForRecords(t *testing.T) {
+	records := []libdns.Record{
+		libdns.TXT{Name: "_acme-challenge", TTL: time.Minute, Text: `token "quoted"`},
+		libdns.RR{Name: "www", Type: "AAAA", TTL: time.Minute, Data: "2001:DB8:0::1"},
+		libdns.MX{Name: "@", TTL: time.Minute, Preference: 10, Target: "Mail.example.com."},
+	}
+	tests := []struct {
+		name     string
+		zoneNS   bool
+		lag1     int64
+		lag2     int64
+		wantErr  string
+		minQuery int64
+	}{
+		{"served", true, 0, 0, "", 6},
+		{"lagging", true, 0, 6, "", 12},
+		{"never", true, 0, -1, "at ns2.example.com.", 3},
+		{"primary_nameserver", false, 2, -1, "", 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := glesystest.NewServer()
+			defer s.Close()
+			if tt.zoneNS {
+				s.AddZone("example.com",
+					libdns.NS{Name: "@", TTL: time.Hour, Target: "ns1.example.com."},
+					libdns.NS{Name: "@", TTL: time.Hour, Target: "ns2.example.com."},
+				)
+			} else {
+				s.AddZone("example.com")
+			}
+			ns1, queries1 := newTestNameserver(t, s, "example.com", tt.lag1)
+			ns2, queries2 := newTestNameserver(t, s, "example.com", tt.lag2)
+			p := s.Provider()
+			p.PollingInterval = time.Millisecond
+			p.PropagationTimeout = 200 * time.Millisecond
+			p.DNSExchanger = &redirectExchanger{to: map[string]string{
+				"ns1.example.com":   ns1,
+				"ns2.example.com":   ns2,
+				"ns1.namesystem.se": ns1,
+			}}
+			ctx := context.Background()
+			if _, err := p.AppendRecords(ctx, "example.com", records); err != nil {
+				t.Fatal(err)
+			}
+
+			err := p.WaitForRecords(ctx, "example.com.", records)
+
+			if tt.wantErr != "" {
+				if !errors.Is(err, glesys.ErrNotPropagated) || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("WaitForRecords() error = %v, want ErrNotPropagated and %q", err, tt.wantErr)
+				}
+				if strings.Contains(err.Error(), "at ns1.example.com.") {
+					t.Errorf("WaitForRecords() error = %v, ns1 serves the records", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("WaitForRecords() error = %v", err)
+			}
+			if n := queries1.Load() + queries2.Load(); n < tt.minQuery {
+				t.Errorf("name servers got %d queries, want at least %d", n, tt.minQuery)
+			}
+		})
+	}
+}
+
+func TestProvider_WaitForRecordsCancel(t *testing.T) {
+	s := glesystest.NewServer()
+	defer s.Close()
+	s.AddZone("example.com", libdns.NS{Name: "@", TTL: time.Hour, Target: "ns1.example.com."})
+	ns1, _ := newTestNameserver(t, s, "example.com", -1)
+	p := s.Provider()
+	p.PollingInterval = time.Millisecond
+	p.DNSExchanger = &redirectExchanger{to: map[string]string{"ns1.example.com": ns1}}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	err := p.WaitForRecords(ctx, "example.com", []libdns.Record{addr("www", "192.0.2.1")})
+
+	if !errors.Is(err, glesys.ErrNotPropagated) {
+		t.Errorf("WaitForRecords() error = %v, want ErrNotPropagated", err)
+	}
+	if time.Since(start) > time.Minute {
+		t.Errorf("WaitForRecords() did not stop when the context was done")
+	}
+}
+
+func TestProvider_WaitForRecordsTruncated(t *testing.T) {
+	s := glesystest.NewServer()
+	defer s.Close()
+	s.AddZone("example.com", libdns.NS{Name: "@", TTL: time.Hour, Target: "ns1.example.com."})
+	ns1, queries := newTestNameserver(t, s, "example.com", 0)
+	p := s.Provider()
+	p.PollingInterval = time.Millisecond
+	p.PropagationTimeout = 200 * time.Millisecond
+	udp := &truncatingExchanger{}
+	p.DNSExchanger = udp
+	p.DNSTCPExchanger = &redirectExchanger{to: map[string]string{"ns1.example.com": ns1}}
+	records := []libdns.Record{libdns.TXT{Name: "_acme-challenge", TTL: time.Minute, Text: "token"}}
+	ctx := context.Background()
+	if _, err := p.AppendRecords(ctx, "example.com", records); err != nil {
+		t.Fatal(err)
+	}
+
+	err := p.WaitForRecords(ctx, "example.com", records)
+
+	if err != nil {
+		t.Fatalf("WaitForRecords() error = %v", err)
+	}
+	if udp.queries.Load() == 0 || queries.Load() == 0 {
+		t.Errorf("got %d truncated answers and %d retries, want both", udp.queries.Load(), queries.Load())
+	}
+}
@@ -4,9 +4,12 @@ package glesys
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"net/http"
 	"os"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
@@ -14,6 +17,7 @@ import (
 
 	"github.com/libdns/glesys/internal/impl"
 	"github.com/libdns/libdns"
+	"go.opentelemetry.io/otel/trace"
 )
 
 var debug bool
@@ -26,20 +30,84 @@ func init() {
 	}
 }
 
+// Call describes a single GleSYS API call passed through the middleware chain.
+type Call = impl.Call
+
+// Handler performs a Call.
+type Handler = impl.Handler
+
+// Middleware wraps every GleSYS API call made by the Provider.
+// It can be used to add headers, audit, collect metrics or inject faults.
+type Middleware = impl.Middleware
+
 type Provider struct {
 	mutex       sync.Mutex
 	clientCache *impl.Client
+	middlewares []Middleware
 	Project     string `json:"project,omitempty"`
 	APIKey      string `json:"api_key,omitempty"`
+
+	// BaseURL of the GleSYS API. Defaults to https://api.glesys.com.
+	BaseURL string `json:"base_url,omitempty"`
+
+	// HTTPClient is used to send requests to the GleSYS API.
+	// http.DefaultClient is used if nil.
+	HTTPClient *http.Client `json:"-"`
+
+	// TracerProvider is used to create OpenTelemetry spans for every
+	// Provider method and GleSYS API call. No spans are created if nil.
+	TracerProvider trace.TracerProvider `json:"-"`
+
+	// MaxDeletions is the most records SyncZone and Sync may delete in
+	// one call. There is no limit if zero.
+	MaxDeletions int `json:"max_deletions,omitempty"`
+
+	// PropagationTimeout limits how long WaitForRecords waits.
+	// Defaults to 2 minutes.
+	PropagationTimeout time.Duration `json:"propagation_timeout,omitempty"`
+
+	// PollingInterval is how often WaitForRecords queries the name
+	// servers. Defaults to 2 seconds.
+	PollingInterval time.Duration `json:"polling_interval,omitempty"`
+
+	// DNSExchanger sends the queries of WaitForRecords and
+	// CheckDelegation. A dns.Client using UDP is used if nil.
+	DNSExchanger Exchanger `json:"-"`
+
+	// DNSTCPExchanger sends a query again when the answer through
+	// DNSExchanger is truncated. A dns.Client using TCP is used if nil.
+	DNSTCPExchanger Exchanger `json:"-"`
 }
 
 func (p *Provider) client() *impl.Client {
 	if p.clientCache == nil {
 		p.clientCache = impl.NewClient(p.Project, p.APIKey, "libdns-glesys/0.0.2")
+		if p.BaseURL != "" {
+			if err := p.clientCache.SetBaseURL(p.BaseURL); err != nil {
+				// fail every request rather than silently using the default API
+				p.clientCache.BaseURL = nil
+			}
+		}
+		if p.HTTPClient != nil {
+			p.clientCache.SetHTTPClient(p.HTTPClient)
+		}
+		p.clientCache.Use(p.tracingMiddleware)
+		p.clientCache.Use(p.middlewares...)
 	}
 	return p.clientCache
 }
 
+// Use registers middleware that wraps every GleSYS API call.
+// The first middleware registered is the outermost one.
+func (p *Provider) Use(mw ...Middleware) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.middlewares = append(p.middlewares, mw...)
+	if p.clientCache != nil {
+		p.clientCache.Use(mw...)
+	}
+}
+
 type recordWithMatchingGlesys struct {
 	Record  libdns.Record
 	Matches []impl.DNSDomainRecord
@@ -57,18 +125,10 @@ func (p *Provider) getMatchingRecords(ctx context.Context, zone string, records
 	if err != nil {
 		return nil, err
 	}
+	idx := newRecordIndex(*existingRecords)
 	results := []recordWithMatchingGlesys{}
 	for _, r := range records {
-		rr := r.RR()
-		matches := []impl.DNSDomainRecord{}
-		for _, dr := range *existingRecords {
-			hasMatching := checkParamsMatching(rr, &dr)
-			if !hasMatching.all() {
-				continue
-			}
-			matches = append(matches, dr)
-		}
-		results = append(results, recordWithMatchingGlesys{Record: r, Matches: matches})
+		results = append(results, recordWithMatchingGlesys{Record: r, Matches: idx.match(r.RR())})
 	}
 	if debug {
 		log.Printf("getMatchingRecords result: %+v", results)
@@ -76,43 +136,17 @@ func (p *Provider) getMatchingRecords(ctx context.Context, zone string, records
 	return results, nil
 }
 
-type recordWithMatchingLibDNS struct {
-	Record  impl.DNSDomainRecord
-	Matches []libdns.Record
-}
-
-func (p *Provider) getMatchingRecordsLibDNS(ctx context.Context, zone string, records []libdns.Record) ([]recordWithMatchingLibDNS, error) {
-	zone = cleanZ(zone)
-	if debug {
-		log.Printf("getMatchingRecordsLibDNS zone=%s", zone)
-	}
-	existingRecords, err := p.client().DNSDomains.ListRecords(ctx, zone)
-	if err != nil {
-		return nil, err
-	}
-	results := []recordWithMatchingLibDNS{}
-	for _, dr := range *existingRecords {
-		matches := []libdns.Record{}
-		for _, r := range records {
-			rr := r.RR()
-			hasMatching := checkParamsMatching(rr, &dr)
-			if !hasMatching.all() {
-				continue
-			}
-			matches = append(matches, r)
-		}
-		results = append(results, recordWithMatchingLibDNS{Record: dr, Matches: matches})
-	}
-	if debug {
-		log.Printf("getMatchingRecordsLibDNS result: %+v", results)
-	}
-	return results, nil
-}
-
 // GetRecords lists all the records in the zone.
 func (p *Provider) GetRecords(ctx context.Context, zone string) ([]libdns.Record, error) {
+	ctx, span := p.startSpan(ctx, "GetRecords", zone, nil)
 	p.mutex.Lock()
 	defer p.mutex.Unlock()
+	records, err := p.getRecords(ctx, zone)
+	endSpan(span, records, err)
+	return records, err
+}
+
+func (p *Provider) getRecords(ctx context.Context, zone string) ([]libdns.Record, error) {
 	zone = cleanZ(zone)
 	if debug {
 		log.Printf("GetRecords zone=%s", zone)
@@ -141,8 +175,15 @@ func (p *Provider) GetRecords(ctx context.Context, zone string) ([]libdns.Record
 
 // AppendRecords adds records to the zone. It returns the records that were added.
 func (p *Provider) AppendRecords(ctx context.Context, zone string, records []libdns.Record) ([]libdns.Record, error) {
+	ctx, span := p.startSpan(ctx, "AppendRecords", zone, records)
 	p.mutex.Lock()
 	defer p.mutex.Unlock()
+	results, err := p.appendRecords(ctx, zone, records)
+	endSpan(span, results, err)
+	return results, err
+}
+
+func (p *Provider) appendRecords(ctx context.Context, zone string, records []libdns.Record) ([]libdns.Record, error) {
 	zone = cleanZ(zone)
 	if debug {
 		log.Printf("AppendRecords zone=%s", zone)
@@ -181,160 +222,309 @@ func (p *Provider) AppendRecords(ctx context.Context, zone string, records []lib
 // In RFC 9499 terms, SetRecords appends, modifies, or deletes records in the
 // zone so that for each RRset in the input, the records provided in the input
 // are the only members of their RRset in the output zone.
-// Calls to SetRecords are presumed to be atomic;
+// Calls to SetRecords are presumed to be atomic; if any change fails
+// the changes already made are reverted.
 // It returns the updated records.
 func (p *Provider) SetRecords(ctx context.Context, zone string, records []libdns.Record) ([]libdns.Record, error) {
+	ctx, span := p.startSpan(ctx, "SetRecords", zone, records)
 	p.mutex.Lock()
 	defer p.mutex.Unlock()
+	results, err := p.setRecords(ctx, zone, records)
+	endSpan(span, results, err)
+	return results, err
+}
+
+func (p *Provider) setRecords(ctx context.Context, zone string, records []libdns.Record) ([]libdns.Record, error) {
 	zone = cleanZ(zone)
 	if debug {
 		log.Printf("SetRecords zone=%s", zone)
 	}
-
-	type updateChange struct {
-		From impl.DNSDomainRecord
-		To   impl.DNSDomainRecord
+	existing, err := p.client().DNSDomains.ListRecords(ctx, zone)
+	if err != nil {
+		return nil, err
 	}
-
-	type changes struct {
-		updates   []updateChange
-		deletes   []impl.DNSDomainRecord
-		additions []impl.DNSDomainRecord
+	done, err := p.applyChanges(ctx, zone, planSetRecords(zone, *existing, records))
+	if err != nil {
+		return nil, err
+	}
+	results := []libdns.Record{}
+	for _, dr := range done.unchanged {
+		results = append(results, toLibDNSOrRR(&dr))
+	}
+	for _, u := range done.updates {
+		results = append(results, toLibDNSOrRR(&u.To))
+	}
+	for _, dr := range done.additions {
+		results = append(results, toLibDNSOrRR(&dr))
+	}
+	if debug {
+		log.Printf("SetRecords result: %+v", results)
 	}
+	return results, nil
+}
+
+type recordUpdate struct {
+	From impl.DNSDomainRecord
+	To   impl.DNSDomainRecord
+}
 
-	wanted := changes{
-		updates:   []updateChange{},
-		deletes:   []impl.DNSDomainRecord{},
-		additions: []impl.DNSDomainRecord{},
+// changeSet is a set of changes to the records of a zone.
+type changeSet struct {
+	additions []impl.DNSDomainRecord
+	updates   []recordUpdate
+	deletes   []impl.DNSDomainRecord
+	unchanged []impl.DNSDomainRecord
+}
+
+// empty returns true if cs makes no changes.
+func (cs changeSet) empty() bool {
+	return len(cs.additions) == 0 && len(cs.updates) == 0 && len(cs.deletes) == 0
+}
+
+// String lists the changes one per line, prefixed with +, ~ or -.
+func (cs changeSet) String() string {
+	format := func(dr impl.DNSDomainRecord) string {
+		return fmt.Sprintf("%s %d %s %s", dr.Host, dr.TTL, dr.Type, dr.Data)
+	}
+	sb := &strings.Builder{}
+	for _, dr := range cs.additions {
+		fmt.Fprintf(sb, "+ %s\n", format(dr))
 	}
-	executed := changes{
-		updates:   []updateChange{},
-		deletes:   []impl.DNSDomainRecord{},
-		additions: []impl.DNSDomainRecord{},
+	for _, u := range cs.updates {
+		fmt.Fprintf(sb, "~ %s -> %s\n", format(u.From), format(u.To))
 	}
+	for _, dr := range cs.deletes {
+		fmt.Fprintf(sb, "- %s\n", format(dr))
+	}
+	return sb.String()
+}
 
-	makeAfter := func(inErr error) ([]libdns.Record, error) {
-		if inErr != nil {
-			// revert the changes
-			for _, dr := range wanted.deletes {
-				// add the record back
-				param := impl.AddRecordParams{
-					DomainName: zone,
-					Host:       dr.Host,
-					Data:       dr.Data,
-					TTL:        dr.TTL,
-					Type:       strings.ToUpper(dr.Type),
-				}
-				_, err := p.client().DNSDomains.AddRecord(ctx, param)
-				if err != nil {
-					return nil, err
-				}
-			}
-			for _, dr := range wanted.updates {
-				// update the record back
-				param := impl.UpdateRecordParams{
-					RecordID: dr.From.RecordID,
-					Host:     dr.From.Host,
-					Data:     dr.From.Data,
-					TTL:      dr.From.TTL,
-					Type:     strings.ToUpper(dr.From.Type),
-				}
-				_, err := p.client().DNSDomains.UpdateRecord(ctx, param)
-				if err != nil {
-					return nil, err
-				}
-			}
-			for _, dr := range wanted.additions {
-				// delete the record
-				err := p.client().DNSDomains.DeleteRecord(ctx, dr.RecordID)
-				if err != nil {
-					return nil, err
-				}
-			}
-			return nil, inErr
-		}
-		after := []libdns.Record{}
-		for _, dr := range wanted.additions {
-			after = append(after, mustToLibDNS(&dr))
-		}
-		for _, dr := range wanted.updates {
-			after = append(after, mustToLibDNS(&dr.To))
+// planSetRecords compares the existing records of a zone with the
+// records given to SetRecords and returns the changes needed so that each
+// RRset in records replaces the corresponding RRset in the zone.
+// Existing records are reused by updating them where possible. A record
+// with a zero TTL matches an existing record with any TTL.
+func planSetRecords(zone string, existing []impl.DNSDomainRecord, records []libdns.Record) changeSet {
+	type rrset struct {
+		name    string
+		typ     string
+		desired []libdns.RR
+	}
+	sets := []*rrset{}
+	byKey := map[string]*rrset{}
+	for _, r := range records {
+		rr := r.RR()
+		rr.Type = strings.ToUpper(rr.Type)
+		key := rr.Name + " " + rr.Type
+		set, ok := byKey[key]
+		if !ok {
+			set = &rrset{name: rr.Name, typ: rr.Type}
+			byKey[key] = set
+			sets = append(sets, set)
 		}
-		return after, nil
+		set.desired = append(set.desired, rr)
 	}
 
-	// find the records that need to be updated or deleted
-	matching, err := p.getMatchingRecords(ctx, zone, records)
-	if err != nil {
-		return makeAfter(err)
-	}
-	for _, m := range matching {
-		if len(m.Matches) == 0 {
-			// no matches, record needs to be added
-			wanted.additions = append(wanted.additions, impl.DNSDomainRecord{
-				DomainName: zone,
-				Host:       m.Record.RR().Name,
-				Data:       m.Record.RR().Data,
-				TTL:        int(m.Record.RR().TTL / time.Second),
-				Type:       strings.ToUpper(m.Record.RR().Type),
-			})
-			continue
+	idx := newRecordIndex(existing)
+	cs := changeSet{}
+	for _, set := range sets {
+		current := idx.lookup(set.name, set.typ)
+		// keep or update records where the data is the same
+		pending := []libdns.RR{}
+		seen := map[string]bool{}
+		for _, rr := range set.desired {
+			if seen[rr.Data] {
+				continue
+			}
+			seen[rr.Data] = true
+			i := slices.IndexFunc(current, func(dr impl.DNSDomainRecord) bool { return dr.Data == rr.Data })
+			if i < 0 {
+				pending = append(pending, rr)
+				continue
+			}
+			dr := current[i]
+			current = slices.Delete(current, i, i+1)
+			ttl := int(rr.TTL / time.Second)
+			if ttl == 0 || ttl == dr.TTL {
+				cs.unchanged = append(cs.unchanged, dr)
+				continue
+			}
+			to := dr
+			to.TTL = ttl
+			cs.updates = append(cs.updates, recordUpdate{From: dr, To: to})
 		}
-		for _, dr := range m.Matches {
-			if dr.Type == m.Record.RR().Type && dr.Host == m.Record.RR().Name && dr.Data == m.Record.RR().Data && dr.TTL == int(m.Record.RR().TTL/time.Second) {
-				// record already exists, no need to update
+		// reuse the remaining records for new data before adding any
+		for _, rr := range pending {
+			ttl := int(rr.TTL / time.Second)
+			if len(current) > 0 {
+				dr := current[0]
+				current = current[1:]
+				to := dr
+				to.Data = rr.Data
+				if ttl != 0 {
+					to.TTL = ttl
+				}
+				cs.updates = append(cs.updates, recordUpdate{From: dr, To: to})
 				continue
 			}
-			// record needs to be updated
-			wanted.updates = append(wanted.updates, updateChange{
-				From: dr,
-				To: impl.DNSDomainRecord{
-					DomainName: dr.DomainName,
-					RecordID:   dr.RecordID,
-					Host:       dr.Host,
-					Data:       m.Record.RR().Data,
-					TTL:        int(m.Record.RR().TTL / time.Second),
-					Type:       strings.ToUpper(m.Record.RR().Type),
-				},
+			cs.additions = append(cs.additions, impl.DNSDomainRecord{
+				DomainName: zone,
+				Host:       set.name,
+				Data:       rr.Data,
+				TTL:        ttl,
+				Type:       set.typ,
 			})
 		}
-		// record needs to be deleted
-		wanted.deletes = append(wanted.deletes, m.Matches...)
+		// whatever is left is no longer part of the RRset
+		cs.deletes = append(cs.deletes, current...)
+	}
+	return cs
+}
 
+// rrsetKeys returns the nameTypeKey of the RRset of every record.
+func rrsetKeys(records []libdns.Record) map[string]bool {
+	keys := map[string]bool{}
+	for _, r := range records {
+		rr := r.RR()
+		keys[nameTypeKey(rr.Name, rr.Type)] = true
 	}
+	return keys
+}
 
-	// changes needs to be atomic so in case of failure we need to
-	// revert the changes
-	// we need to delete the records that are not in the wanted list
+// planZone is like planSetRecords, but it also deletes the records of
+// every RRset not in records, so that the zone ends up with exactly
+// the given records.
+func planZone(zone string, existing []impl.DNSDomainRecord, records []libdns.Record) changeSet {
+	cs := planSetRecords(zone, existing, records)
+	keep := rrsetKeys(records)
+	for _, dr := range existing {
+		if !keep[nameTypeKey(dr.Host, dr.Type)] {
+			cs.deletes = append(cs.deletes, dr)
+		}
+	}
+	return cs
+}
 
-	// delete the records that need to be deleted
-	for _, dr := range wanted.deletes {
-		err = p.client().DNSDomains.DeleteRecord(ctx, dr.RecordID)
+// rollbackTimeout limits how long reverting a failed change set may take.
+const rollbackTimeout = 30 * time.Second
+
+// applyChanges applies the additions, updates and deletes in cs, in that
+// order. If any change fails, the changes already made are reverted so that
+// the zone is left as it was, including the failed change if the API
+// applied it anyway. It returns the changes that were made, with
+// the records as returned by the API.
+func (p *Provider) applyChanges(ctx context.Context, zone string, cs changeSet) (changeSet, error) {
+	done := changeSet{unchanged: cs.unchanged}
+	// pending is the change whose call failed. The API may have applied
+	// it anyway, e.g. when the client gave up waiting for the response.
+	fail := func(err error, pending changeSet) (changeSet, error) {
+		rerr := p.resolvePending(ctx, zone, cs, &done, pending)
+		rerr = errors.Join(rerr, p.revertChanges(ctx, zone, done))
+		if rerr != nil {
+			return changeSet{}, errors.Join(err, fmt.Errorf("failed to revert changes: %w", rerr))
+		}
+		return changeSet{}, err
+	}
+
+	for _, dr := range cs.additions {
+		param := impl.AddRecordParams{
+			DomainName: zone,
+			Host:       dr.Host,
+			Data:       dr.Data,
+			TTL:        dr.TTL,
+			Type:       strings.ToUpper(dr.Type),
+		}
+		added, err := p.client().DNSDomains.AddRecord(ctx, param)
 		if err != nil {
-			return makeAfter(err)
+			return fail(err, changeSet{additions: []impl.DNSDomainRecord{dr}})
 		}
-		executed.deletes = append(executed.deletes, dr)
+		done.additions = append(done.additions, *added)
 	}
-	// update the records that need to be updated
-	for _, dr := range wanted.updates {
+	for _, u := range cs.updates {
 		param := impl.UpdateRecordParams{
-			RecordID: dr.From.RecordID,
-			Host:     dr.To.Host,
-			Data:     dr.To.Data,
-			TTL:      dr.To.TTL,
-			Type:     strings.ToUpper(dr.To.Type),
+			RecordID: u.From.RecordID,
+			Host:     u.To.Host,
+			Data:     u.To.Data,
+			TTL:      &u.To.TTL,
+			Type:     strings.ToUpper(u.To.Type),
 		}
-		_, err = p.client().DNSDomains.UpdateRecord(ctx, param)
+		updated, err := p.client().DNSDomains.UpdateRecord(ctx, param)
 		if err != nil {
-			return makeAfter(err)
+			return fail(err, changeSet{updates: []recordUpdate{u}})
+		}
+		done.updates = append(done.updates, recordUpdate{From: u.From, To: *updated})
+	}
+	for _, dr := range cs.deletes {
+		if err := p.client().DNSDomains.DeleteRecord(ctx, dr.RecordID); err != nil {
+			return fail(err, changeSet{deletes: []impl.DNSDomainRecord{dr}})
+		}
+		done.deletes = append(done.deletes, dr)
+	}
+	return done, nil
+}
+
+// resolvePending lists the zone to find out which of the pending changes
+// of cs were applied although their calls failed, and adds those to done.
+// Like revertChanges it ignores cancellation of ctx.
+func (p *Provider) resolvePending(ctx context.Context, zone string, cs changeSet, done *changeSet, pending changeSet) error {
+	if pending.empty() {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), rollbackTimeout)
+	defer cancel()
+	records, err := p.client().DNSDomains.ListRecords(ctx, zone)
+	if err != nil {
+		return err
+	}
+	current := map[int]impl.DNSDomainRecord{}
+	for _, dr := range *records {
+		current[dr.RecordID] = dr
+	}
+	// records of the plan can not be a pending addition
+	known := map[int]bool{}
+	for _, dr := range slices.Concat(cs.unchanged, cs.deletes, done.additions) {
+		known[dr.RecordID] = true
+	}
+	for _, u := range cs.updates {
+		known[u.From.RecordID] = true
+	}
+
+	for _, want := range pending.additions {
+		for _, dr := range *records {
+			if !known[dr.RecordID] && sameRecord(dr, want) {
+				known[dr.RecordID] = true
+				done.additions = append(done.additions, dr)
+				break
+			}
+		}
+	}
+	for _, u := range pending.updates {
+		if dr, ok := current[u.From.RecordID]; ok && sameRecord(dr, u.To) {
+			done.updates = append(done.updates, recordUpdate{From: u.From, To: dr})
+		}
+	}
+	for _, dr := range pending.deletes {
+		if _, ok := current[dr.RecordID]; !ok {
+			done.deletes = append(done.deletes, dr)
 		}
-		executed.updates = append(executed.updates, updateChange{
-			From: dr.From,
-			To:   dr.To,
-		})
 	}
-	// add the records that need to be added
-	for _, dr := range wanted.additions {
+	return nil
+}
+
+// sameRecord returns true if a and b have the same host, type, TTL and data.
+func sameRecord(a, b impl.DNSDomainRecord) bool {
+	return a.Host == b.Host && strings.EqualFold(a.Type, b.Type) && a.TTL == b.TTL && a.Data == b.Data
+}
+
+// revertChanges undoes the changes in done, in reverse order. It keeps
+// going on errors to restore as much as possible, and it ignores
+// cancellation of ctx since the zone would otherwise be left half changed.
+func (p *Provider) revertChanges(ctx context.Context, zone string, done changeSet) error {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), rollbackTimeout)
+	defer cancel()
+	errs := []error{}
+	for i := len(done.deletes) - 1; i >= 0; i-- {
+		dr := done.deletes[i]
 		param := impl.AddRecordParams{
 			DomainName: zone,
 			Host:       dr.Host,
@@ -342,20 +532,43 @@ func (p *Provider) SetRecords(ctx context.Context, zone string, records []libdns
 			TTL:        dr.TTL,
 			Type:       strings.ToUpper(dr.Type),
 		}
-		dr, err := p.client().DNSDomains.AddRecord(ctx, param)
-		if err != nil {
-			return makeAfter(err)
+		if _, err := p.client().DNSDomains.AddRecord(ctx, param); err != nil {
+			errs = append(errs, err)
 		}
-		executed.additions = append(executed.additions, *dr)
 	}
-
-	return makeAfter(nil)
+	for i := len(done.updates) - 1; i >= 0; i-- {
+		from := done.updates[i].From
+		param := impl.UpdateRecordParams{
+			RecordID: from.RecordID,
+			Host:     from.Host,
+			Data:     from.Data,
+			TTL:      &from.TTL,
+			Type:     strings.ToUpper(from.Type),
+		}
+		if _, err := p.client().DNSDomains.UpdateRecord(ctx, param); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	for i := len(done.additions) - 1; i >= 0; i-- {
+		if err := p.client().DNSDomains.DeleteRecord(ctx, done.additions[i].RecordID); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
 }
 
 // DeleteRecords deletes the records from the zone. It returns the records that were deleted.
+// Empty Type, TTL or Data in the input match any value, but the name must always be given.
 func (p *Provider) DeleteRecords(ctx context.Context, zone string, records []libdns.Record) ([]libdns.Record, error) {
+	ctx, span := p.startSpan(ctx, "DeleteRecords", zone, records)
 	p.mutex.Lock()
 	defer p.mutex.Unlock()
+	results, err := p.deleteRecords(ctx, zone, records)
+	endSpan(span, results, err)
+	return results, err
+}
+
+func (p *Provider) deleteRecords(ctx context.Context, zone string, records []libdns.Record) ([]libdns.Record, error) {
 	zone = cleanZ(zone)
 	if debug {
 		log.Printf("DeleteRecords zone=%s", zone)
@@ -365,8 +578,17 @@ func (p *Provider) DeleteRecords(ctx context.Context, zone string, records []lib
 		return nil, err
 	}
 	results := []libdns.Record{}
+	deleted := map[int]bool{}
 	for _, m := range matching {
+		if m.Record.RR().Name == "" {
+			// the name must always be specified, it is never a wildcard
+			continue
+		}
 		for _, dr := range m.Matches {
+			if deleted[dr.RecordID] {
+				continue
+			}
+			deleted[dr.RecordID] = true
 			err = p.client().DNSDomains.DeleteRecord(ctx, dr.RecordID)
 			if err != nil {
 				return results, err
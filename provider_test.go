@@ -5,7 +5,8 @@ package glesys
 
 import (
 	"context"
-	"os"
+	"net/http"
+	"net/http/httptest"
 	"reflect"
 	"testing"
 	"time"
@@ -15,35 +16,24 @@ import (
 )
 
 func TestProvider_GetRecordsIntegration(t *testing.T) {
-	skipUnauth(t)
-	type fields struct {
-		Project string
-		APIKey  string
-	}
 	type args struct {
-		ctx  context.Context
-		zone string
+		ctx context.Context
 	}
 	tests := []struct {
 		name    string
-		fields  fields
 		args    args
 		wantErr bool
 	}{
 		{"first_test",
-			fields{os.Getenv("GLESYS_PROJECT"), os.Getenv("GLESYS_KEY")},
-			args{context.TODO(), os.Getenv("GLESYS_ZONE")},
+			args{context.TODO()},
 			false,
 		},
 		// TODO: Add test cases.
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			p := &Provider{
-				Project: tt.fields.Project,
-				APIKey:  tt.fields.APIKey,
-			}
-			got, err := p.GetRecords(tt.args.ctx, tt.args.zone)
+			p, zone := cassetteProvider(t)
+			got, err := p.GetRecords(tt.args.ctx, zone)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("Provider.GetRecords() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -87,29 +77,20 @@ func mustRRParse(t *testing.T, r libdns.RR) libdns.Record {
 }
 
 func TestProvider_AppendAndDeleteRecordsIntegration(t *testing.T) {
-	skipUnauth(t)
-	type fields struct {
-		Project string
-		APIKey  string
-	}
 	type args struct {
 		ctx     context.Context
-		zone    string
 		records []libdns.Record
 	}
 	tests := []struct {
 		name    string
-		fields  fields
 		args    args
 		wantErr bool
 	}{
 		{"create_txt_record",
-			fields{os.Getenv("GLESYS_PROJECT"), os.Getenv("GLESYS_KEY")},
 			args{
 				context.TODO(),
-				os.Getenv("GLESYS_ZONE"),
 				[]libdns.Record{
-					mustRRParse(t, libdns.RR{Type: "TXT", TTL: time.Minute * 5, Name: "_libdns-test", Data: time.Now().Local().String()}),
+					mustRRParse(t, libdns.RR{Type: "TXT", TTL: time.Minute * 5, Name: "_libdns-test", Data: "libdns-glesys integration test"}),
 				},
 			},
 			false,
@@ -118,11 +99,8 @@ func TestProvider_AppendAndDeleteRecordsIntegration(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			p := &Provider{
-				Project: tt.fields.Project,
-				APIKey:  tt.fields.APIKey,
-			}
-			got, err := p.AppendRecords(tt.args.ctx, tt.args.zone, tt.args.records)
+			p, zone := cassetteProvider(t)
+			got, err := p.AppendRecords(tt.args.ctx, zone, tt.args.records)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("Provider.AppendRecords() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -149,7 +127,7 @@ func TestProvider_AppendAndDeleteRecordsIntegration(t *testing.T) {
 			}
 
 			// Delete the same
-			gotDeleted, err := p.DeleteRecords(context.TODO(), tt.args.zone, got)
+			gotDeleted, err := p.DeleteRecords(context.TODO(), zone, got)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("Provider.DeleteRecords() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -162,28 +140,19 @@ func TestProvider_AppendAndDeleteRecordsIntegration(t *testing.T) {
 }
 
 func TestProvider_getMatchingRecords(t *testing.T) {
-	skipUnauth(t)
-	type fields struct {
-		Project string
-		APIKey  string
-	}
 	type args struct {
 		ctx     context.Context
-		zone    string
 		records []libdns.Record
 	}
 	tests := []struct {
 		name    string
-		fields  fields
 		args    args
 		want    []recordWithMatchingGlesys
 		wantErr bool
 	}{
 		{"getting_matching_records",
-			fields{os.Getenv("GLESYS_PROJECT"), os.Getenv("GLESYS_KEY")},
 			args{
 				context.TODO(),
-				os.Getenv("GLESYS_ZONE"),
 				[]libdns.Record{
 					mustRRParse(t, libdns.RR{Type: "TXT", Name: "_libdns-test"}),
 				},
@@ -200,11 +169,8 @@ func TestProvider_getMatchingRecords(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			p := &Provider{
-				Project: tt.fields.Project,
-				APIKey:  tt.fields.APIKey,
-			}
-			got, err := p.getMatchingRecords(tt.args.ctx, tt.args.zone, tt.args.records)
+			p, zone := cassetteProvider(t)
+			got, err := p.getMatchingRecords(tt.args.ctx, zone, tt.args.records)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("Provider.getMatchingRecords() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -215,3 +181,43 @@ func TestProvider_getMatchingRecords(t *testing.T) {
 		})
 	}
 }
+
+// newTestProvider returns a Provider talking to a test server using handler.
+func newTestProvider(t *testing.T, handler http.HandlerFunc) *Provider {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	p := &Provider{Project: "cl12345", APIKey: "secret"}
+	if err := p.client().SetBaseURL(server.URL); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+const listRecordsResponse = `{"response": {"records": [
+	{"domainname": "example.com", "recordid": 1, "host": "www", "type": "A", "data": "192.0.2.1", "ttl": 3600}
+]}}`
+
+func TestProvider_Use(t *testing.T) {
+	p := newTestProvider(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(listRecordsResponse))
+	})
+	paths := []string{}
+	p.Use(func(next Handler) Handler {
+		return func(call *Call) error {
+			paths = append(paths, call.Path)
+			return next(call)
+		}
+	})
+
+	got, err := p.GetRecords(context.TODO(), "example.com.")
+	if err != nil {
+		t.Fatalf("Provider.GetRecords() error = %v", err)
+	}
+	if len(got) != 1 {
+		t.Errorf("Expected 1 record. Got %v", len(got))
+	}
+	if !reflect.DeepEqual(paths, []string{"domain/listrecords"}) {
+		t.Errorf("Middleware saw paths %v", paths)
+	}
+}
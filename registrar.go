@@ -0,0 +1,310 @@
+// SPDX-FileCopyrightText: 2024 Peter Magnusson <me@kmpm.se>
+// SPDX-License-Identifier: MIT
+
+package glesys
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/libdns/glesys/internal/impl"
+)
+
+// ErrConfirmationRequired is returned by registrar calls that incur cost
+// when they are made without Confirm set.
+var ErrConfirmationRequired = errors.New("confirmation required for a call that incurs cost")
+
+// Registrar registers and manages domains through GleSYS.
+// Get one from Provider.Registrar.
+type Registrar struct {
+	p *Provider
+}
+
+// Registrar returns the registrar API of the provider.
+func (p *Provider) Registrar() *Registrar {
+	return &Registrar{p: p}
+}
+
+// Price is what a domain costs for a number of years.
+type Price struct {
+	Amount   float64 `json:"amount"`
+	Currency string  `json:"currency"`
+	Years    int     `json:"years"`
+}
+
+// Availability tells whether a domain can be registered and at what price.
+type Availability struct {
+	Name      string  `json:"name"`
+	Available bool    `json:"available"`
+	Prices    []Price `json:"prices"`
+}
+
+// Contact is the registrant of a domain.
+type Contact struct {
+	Firstname    string
+	Lastname     string
+	Organization string
+	// NationalID is the personal or organization number of the registrant.
+	NationalID  int
+	Email       string
+	PhoneNumber string
+	FaxNumber   string
+	Address     string
+	City        string
+	ZipCode     string
+	// Country is the ISO 3166-1 alpha-2 country code, e.g. "SE".
+	Country string
+}
+
+// validate checks that the fields GleSYS requires are set.
+func (c Contact) validate() error {
+	required := []struct{ name, value string }{
+		{"firstname", c.Firstname},
+		{"lastname", c.Lastname},
+		{"email", c.Email},
+		{"phone number", c.PhoneNumber},
+		{"address", c.Address},
+		{"city", c.City},
+		{"zip code", c.ZipCode},
+		{"country", c.Country},
+	}
+	var errs []error
+	for _, r := range required {
+		if r.value == "" {
+			errs = append(errs, fmt.Errorf("%s is required", r.name))
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("invalid contact: %w", err)
+	}
+	return nil
+}
+
+func (c Contact) params(domain string, years int) impl.RegisterDNSDomainParams {
+	return impl.RegisterDNSDomainParams{
+		Name:         domain,
+		Address:      c.Address,
+		City:         c.City,
+		Country:      c.Country,
+		Email:        c.Email,
+		Firstname:    c.Firstname,
+		Lastname:     c.Lastname,
+		NationalID:   c.NationalID,
+		Organization: c.Organization,
+		PhoneNumber:  c.PhoneNumber,
+		ZipCode:      c.ZipCode,
+		FaxNumber:    c.FaxNumber,
+		NumYears:     years,
+	}
+}
+
+// RegisterOptions are the options for Registrar.Register.
+type RegisterOptions struct {
+	Contact Contact
+	// Years to register the domain for. GleSYS uses 1 if zero.
+	Years int
+	// Confirm must be true, registering a domain incurs cost.
+	Confirm bool
+}
+
+// TransferOptions are the options for Registrar.Transfer.
+type TransferOptions struct {
+	Contact Contact
+	// AuthCode is the transfer code from the current registrar.
+	AuthCode string
+	// Years to renew the domain for with the transfer. GleSYS uses 1 if zero.
+	Years int
+	// Confirm must be true, transferring a domain incurs cost.
+	Confirm bool
+}
+
+// RenewOptions are the options for Registrar.Renew.
+type RenewOptions struct {
+	// Years to renew the domain for, at least 1.
+	Years int
+	// Confirm must be true, renewing a domain incurs cost.
+	Confirm bool
+}
+
+// AutoRenewOptions are the options for Registrar.SetAutoRenew.
+type AutoRenewOptions struct {
+	// Enable turns automatic renewal on, or off if false.
+	Enable bool
+	// Confirm must be true to turn automatic renewal on, it incurs cost
+	// when the domain expires.
+	Confirm bool
+}
+
+// Available checks if the domain can be registered and returns the
+// prices. GleSYS may include alternatives under other top level domains.
+func (r *Registrar) Available(ctx context.Context, domain string) ([]Availability, error) {
+	ctx, span := r.p.startSpan(ctx, "Registrar.Available", domain, nil)
+	r.p.mutex.Lock()
+	defer r.p.mutex.Unlock()
+	results, err := r.available(ctx, domain)
+	endSpan(span, nil, err)
+	return results, err
+}
+
+func (r *Registrar) available(ctx context.Context, domain string) ([]Availability, error) {
+	domain = cleanZ(domain)
+	if debug {
+		log.Printf("Registrar.Available domain=%s", domain)
+	}
+	domains, err := r.p.client().DNSDomains.Available(ctx, domain)
+	if err != nil {
+		return nil, err
+	}
+	results := make([]Availability, 0, len(*domains))
+	for _, d := range *domains {
+		a := Availability{Name: d.Name, Available: d.Available, Prices: []Price{}}
+		for _, price := range d.Prices {
+			a.Prices = append(a.Prices, Price(price))
+		}
+		results = append(results, a)
+	}
+	return results, nil
+}
+
+// Register registers the domain. It returns ErrConfirmationRequired
+// unless opts.Confirm is set.
+func (r *Registrar) Register(ctx context.Context, domain string, opts RegisterOptions) (*Zone, error) {
+	ctx, span := r.p.startSpan(ctx, "Registrar.Register", domain, nil)
+	r.p.mutex.Lock()
+	defer r.p.mutex.Unlock()
+	z, err := r.register(ctx, domain, opts)
+	endSpan(span, nil, err)
+	return z, err
+}
+
+func (r *Registrar) register(ctx context.Context, domain string, opts RegisterOptions) (*Zone, error) {
+	domain = cleanZ(domain)
+	if debug {
+		log.Printf("Registrar.Register domain=%s", domain)
+	}
+	if !opts.Confirm {
+		return nil, fmt.Errorf("register %s: %w", domain, ErrConfirmationRequired)
+	}
+	if err := opts.Contact.validate(); err != nil {
+		return nil, err
+	}
+	d, err := r.p.client().DNSDomains.Register(ctx, opts.Contact.params(domain, opts.Years))
+	if err != nil {
+		return nil, err
+	}
+	return toZone(d), nil
+}
+
+// Transfer transfers the domain to GleSYS. It returns
+// ErrConfirmationRequired unless opts.Confirm is set.
+func (r *Registrar) Transfer(ctx context.Context, domain string, opts TransferOptions) (*Zone, error) {
+	ctx, span := r.p.startSpan(ctx, "Registrar.Transfer", domain, nil)
+	r.p.mutex.Lock()
+	defer r.p.mutex.Unlock()
+	z, err := r.transfer(ctx, domain, opts)
+	endSpan(span, nil, err)
+	return z, err
+}
+
+func (r *Registrar) transfer(ctx context.Context, domain string, opts TransferOptions) (*Zone, error) {
+	domain = cleanZ(domain)
+	if debug {
+		log.Printf("Registrar.Transfer domain=%s", domain)
+	}
+	if !opts.Confirm {
+		return nil, fmt.Errorf("transfer %s: %w", domain, ErrConfirmationRequired)
+	}
+	if opts.AuthCode == "" {
+		return nil, fmt.Errorf("transfer %s: auth code is required", domain)
+	}
+	if err := opts.Contact.validate(); err != nil {
+		return nil, err
+	}
+	params := opts.Contact.params(domain, opts.Years)
+	params.AuthCode = opts.AuthCode
+	d, err := r.p.client().DNSDomains.Transfer(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+	return toZone(d), nil
+}
+
+// Renew renews the registration of the domain. It returns
+// ErrConfirmationRequired unless opts.Confirm is set.
+func (r *Registrar) Renew(ctx context.Context, domain string, opts RenewOptions) (*Zone, error) {
+	ctx, span := r.p.startSpan(ctx, "Registrar.Renew", domain, nil)
+	r.p.mutex.Lock()
+	defer r.p.mutex.Unlock()
+	z, err := r.renew(ctx, domain, opts)
+	endSpan(span, nil, err)
+	return z, err
+}
+
+func (r *Registrar) renew(ctx context.Context, domain string, opts RenewOptions) (*Zone, error) {
+	domain = cleanZ(domain)
+	if debug {
+		log.Printf("Registrar.Renew domain=%s", domain)
+	}
+	if !opts.Confirm {
+		return nil, fmt.Errorf("renew %s: %w", domain, ErrConfirmationRequired)
+	}
+	if opts.Years < 1 {
+		return nil, fmt.Errorf("renew %s: years must be at least 1, got %d", domain, opts.Years)
+	}
+	d, err := r.p.client().DNSDomains.Renew(ctx, impl.RenewDNSDomainParams{Name: domain, NumYears: opts.Years})
+	if err != nil {
+		return nil, err
+	}
+	return toZone(d), nil
+}
+
+// SetAutoRenew turns automatic renewal of the domain on or off. Turning
+// it on returns ErrConfirmationRequired unless opts.Confirm is set.
+func (r *Registrar) SetAutoRenew(ctx context.Context, domain string, opts AutoRenewOptions) (*Zone, error) {
+	ctx, span := r.p.startSpan(ctx, "Registrar.SetAutoRenew", domain, nil)
+	r.p.mutex.Lock()
+	defer r.p.mutex.Unlock()
+	z, err := r.setAutoRenew(ctx, domain, opts)
+	endSpan(span, nil, err)
+	return z, err
+}
+
+func (r *Registrar) setAutoRenew(ctx context.Context, domain string, opts AutoRenewOptions) (*Zone, error) {
+	domain = cleanZ(domain)
+	if debug {
+		log.Printf("Registrar.SetAutoRenew domain=%s enable=%v", domain, opts.Enable)
+	}
+	params := impl.SetAutoRenewParams{Name: domain, SetAutoRenew: "no"}
+	if opts.Enable {
+		if !opts.Confirm {
+			return nil, fmt.Errorf("enable auto renew of %s: %w", domain, ErrConfirmationRequired)
+		}
+		params.SetAutoRenew = "yes"
+	}
+	d, err := r.p.client().DNSDomains.SetAutoRenew(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+	return toZone(d), nil
+}
+
+// GenerateAuthCode returns a new auth code for transferring the domain
+// to another registrar.
+func (r *Registrar) GenerateAuthCode(ctx context.Context, domain string) (string, error) {
+	ctx, span := r.p.startSpan(ctx, "Registrar.GenerateAuthCode", domain, nil)
+	r.p.mutex.Lock()
+	defer r.p.mutex.Unlock()
+	code, err := r.generateAuthCode(ctx, domain)
+	endSpan(span, nil, err)
+	return code, err
+}
+
+func (r *Registrar) generateAuthCode(ctx context.Context, domain string) (string, error) {
+	domain = cleanZ(domain)
+	if debug {
+		log.Printf("Registrar.GenerateAuthCode domain=%s", domain)
+	}
+	return r.p.client().DNSDomains.GenerateAuthCode(ctx, domain)
+}
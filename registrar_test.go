@@ -0,0 +1,187 @@
+// SPDX-FileCopyrightText: 2024 Peter Magnusson <me@kmpm.se>
+// SPDX-License-Identifier: MIT
+
+package glesys_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/libdns/glesys"
+	"github.com/libdns/glesys/glesystest"
+)
+
+var testContact = glesys.Contact{
+	Firstname:   "Alice",
+	Lastname:    "Smith",
+	Email:       "alice@example.com",
+	PhoneNumber: "+46.123456",
+	Address:     "Badhusvägen 45",
+	City:        "Falkenberg",
+	ZipCode:     "31132",
+	Country:     "SE",
+}
+
+func TestRegistrar_Available(t *testing.T) {
+	s := glesystest.NewServer()
+	defer s.Close()
+	s.AddZone("example.com")
+	r := s.Provider().Registrar()
+	ctx := context.Background()
+
+	got, err := r.Available(ctx, "example.org")
+
+	if err != nil {
+		t.Fatalf("Available() error = %v", err)
+	}
+	want := []glesys.Availability{{
+		Name:      "example.org",
+		Available: true,
+		Prices:    []glesys.Price{{Amount: 150, Currency: "SEK", Years: 1}, {Amount: 300, Currency: "SEK", Years: 2}},
+	}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Available() = %+v, want %+v", got, want)
+	}
+
+	got, err = r.Available(ctx, "example.com")
+	if err != nil || len(got) != 1 || got[0].Available {
+		t.Errorf("Available() of a registered domain = %+v, %v", got, err)
+	}
+}
+
+func TestRegistrar_ConfirmationRequired(t *testing.T) {
+	s := glesystest.NewServer()
+	defer s.Close()
+	s.AddZone("example.com")
+	counter := s.Inject()
+	r := s.Provider().Registrar()
+	ctx := context.Background()
+
+	calls := map[string]func() error{
+		"register": func() error {
+			_, err := r.Register(ctx, "example.org", glesys.RegisterOptions{Contact: testContact})
+			return err
+		},
+		"transfer": func() error {
+			_, err := r.Transfer(ctx, "example.org", glesys.TransferOptions{Contact: testContact, AuthCode: "code"})
+			return err
+		},
+		"renew": func() error {
+			_, err := r.Renew(ctx, "example.com", glesys.RenewOptions{Years: 1})
+			return err
+		},
+		"setautorenew": func() error {
+			_, err := r.SetAutoRenew(ctx, "example.com", glesys.AutoRenewOptions{Enable: true})
+			return err
+		},
+	}
+	for name, call := range calls {
+		if err := call(); !errors.Is(err, glesys.ErrConfirmationRequired) {
+			t.Errorf("%s without Confirm error = %v, want ErrConfirmationRequired", name, err)
+		}
+		if n := counter.Count("domain/" + name); n != 0 {
+			t.Errorf("%s without Confirm made %d API calls", name, n)
+		}
+	}
+}
+
+func TestRegistrar_Register(t *testing.T) {
+	s := glesystest.NewServer()
+	defer s.Close()
+	r := s.Provider().Registrar()
+	ctx := context.Background()
+
+	z, err := r.Register(ctx, "example.org.", glesys.RegisterOptions{Contact: testContact, Years: 2, Confirm: true})
+
+	if err != nil {
+		t.Fatalf("Register() error = %v", err)
+	}
+	if z.Name != "example.org" || z.Registration == nil || z.Registration.State != "OK" {
+		t.Fatalf("Register() = %+v", z)
+	}
+	if want := time.Now().AddDate(2, 0, 0).Format(time.DateOnly); z.Registration.Expires.Format(time.DateOnly) != want {
+		t.Errorf("Register() expires %v, want %v", z.Registration.Expires, want)
+	}
+
+	_, err = r.Register(ctx, "example.org", glesys.RegisterOptions{Contact: testContact, Confirm: true})
+	if err == nil || !strings.Contains(err.Error(), "already registered") {
+		t.Errorf("Register() twice error = %v", err)
+	}
+}
+
+func TestRegistrar_RegisterInvalidContact(t *testing.T) {
+	s := glesystest.NewServer()
+	defer s.Close()
+
+	_, err := s.Provider().Registrar().Register(context.Background(), "example.org", glesys.RegisterOptions{
+		Contact: glesys.Contact{Firstname: "Alice"},
+		Confirm: true,
+	})
+
+	if err == nil || !strings.Contains(err.Error(), "email is required") || !strings.Contains(err.Error(), "country is required") {
+		t.Errorf("Register() error = %v", err)
+	}
+}
+
+func TestRegistrar_Transfer(t *testing.T) {
+	s := glesystest.NewServer()
+	defer s.Close()
+	r := s.Provider().Registrar()
+	ctx := context.Background()
+
+	_, err := r.Transfer(ctx, "example.org", glesys.TransferOptions{Contact: testContact, Confirm: true})
+	if err == nil || !strings.Contains(err.Error(), "auth code is required") {
+		t.Errorf("Transfer() without auth code error = %v", err)
+	}
+
+	z, err := r.Transfer(ctx, "example.org", glesys.TransferOptions{Contact: testContact, AuthCode: "code", Confirm: true})
+	if err != nil {
+		t.Fatalf("Transfer() error = %v", err)
+	}
+	if z.Registration == nil || z.Registration.State != "PENDING TRANSFER" {
+		t.Errorf("Transfer() = %+v", z.Registration)
+	}
+}
+
+func TestRegistrar_RenewAndAutoRenew(t *testing.T) {
+	s := glesystest.NewServer()
+	defer s.Close()
+	s.AddZone("example.com")
+	r := s.Provider().Registrar()
+	ctx := context.Background()
+
+	z, err := r.Renew(ctx, "example.com", glesys.RenewOptions{Years: 1, Confirm: true})
+	if err != nil {
+		t.Fatalf("Renew() error = %v", err)
+	}
+	if want := time.Now().AddDate(2, 0, 0).Format(time.DateOnly); z.Registration.Expires.Format(time.DateOnly) != want {
+		t.Errorf("Renew() expires %v, want %v", z.Registration.Expires, want)
+	}
+	if _, err := r.Renew(ctx, "example.com", glesys.RenewOptions{Confirm: true}); err == nil {
+		t.Errorf("Renew() for 0 years did not fail")
+	}
+
+	z, err = r.SetAutoRenew(ctx, "example.com", glesys.AutoRenewOptions{})
+	if err != nil {
+		t.Fatalf("SetAutoRenew() error = %v", err)
+	}
+	if z.Registration.AutoRenew {
+		t.Errorf("SetAutoRenew() left auto renew on")
+	}
+	z, err = r.SetAutoRenew(ctx, "example.com", glesys.AutoRenewOptions{Enable: true, Confirm: true})
+	if err != nil {
+		t.Fatalf("SetAutoRenew(Enable) error = %v", err)
+	}
+	if !z.Registration.AutoRenew {
+		t.Errorf("SetAutoRenew(Enable) left auto renew off")
+	}
+
+	code, err := r.GenerateAuthCode(ctx, "example.com")
+	if err != nil || code == "" {
+		t.Errorf("GenerateAuthCode() = %q, %v", code, err)
+	}
+}
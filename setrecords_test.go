@@ -0,0 +1,128 @@
+// SPDX-FileCopyrightText: 2024 Peter Magnusson <me@kmpm.se>
+// SPDX-License-Identifier: MIT
+
+package glesys_test
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/libdns/glesys/glesystest"
+	"github.com/libdns/libdns"
+)
+
+// zoneState returns the records of a zone without record IDs, sorted,
+// so states of different servers can be compared.
+func zoneState(s *glesystest.Server, zone string) []string {
+	state := []string{}
+	for _, r := range s.Records(zone) {
+		state = append(state, fmt.Sprintf("%s %d %s %s", r.Host, r.TTL, r.Type, r.Data))
+	}
+	sort.Strings(state)
+	return state
+}
+
+var setRecordsInitial = []libdns.Record{
+	libdns.Address{Name: "www", TTL: time.Hour, IP: netip.MustParseAddr("192.0.2.1")},
+	libdns.Address{Name: "www", TTL: time.Hour, IP: netip.MustParseAddr("192.0.2.2")},
+	libdns.TXT{Name: "txt", TTL: time.Hour, Text: "a"},
+	libdns.TXT{Name: "txt", TTL: time.Hour, Text: "b"},
+	libdns.CNAME{Name: "mail", TTL: time.Hour, Target: "mail.example.net."},
+}
+
+// setRecordsInput needs 2 additions, 2 updates and 1 delete.
+var setRecordsInput = []libdns.Record{
+	libdns.Address{Name: "www", TTL: 10 * time.Minute, IP: netip.MustParseAddr("192.0.2.2")},
+	libdns.Address{Name: "www", TTL: time.Hour, IP: netip.MustParseAddr("192.0.2.3")},
+	libdns.Address{Name: "www", TTL: time.Hour, IP: netip.MustParseAddr("192.0.2.4")},
+	libdns.TXT{Name: "txt", TTL: time.Hour, Text: "a"},
+	libdns.Address{Name: "v6", TTL: time.Hour, IP: netip.MustParseAddr("2001:db8::1")},
+}
+
+func setRecordsFaults() []glesystest.Fault {
+	calls := map[string]int{
+		"domain/listrecords":  1,
+		"domain/addrecord":    2,
+		"domain/updaterecord": 2,
+		"domain/deleterecord": 1,
+	}
+	faults := []glesystest.Fault{}
+	for endpoint, n := range calls {
+		for nth := 1; nth <= n; nth++ {
+			for _, kind := range []glesystest.FaultKind{glesystest.FaultError, glesystest.FaultMalformed, glesystest.FaultDelay, glesystest.FaultSlowResponse} {
+				faults = append(faults, glesystest.Fault{Endpoint: endpoint, Nth: nth, Kind: kind, Delay: 5 * time.Second})
+			}
+		}
+	}
+	sort.Slice(faults, func(i, j int) bool { return faults[i].String() < faults[j].String() })
+	return faults
+}
+
+func TestProvider_SetRecordsFaults(t *testing.T) {
+	reference := glesystest.NewServer()
+	defer reference.Close()
+	reference.AddZone("example.com", setRecordsInitial...)
+	if _, err := reference.Provider().SetRecords(context.Background(), "example.com", setRecordsInput); err != nil {
+		t.Fatalf("SetRecords() without faults error = %v", err)
+	}
+	applied := zoneState(reference, "example.com")
+
+	for _, side := range []string{"server", "client"} {
+		for _, fault := range setRecordsFaults() {
+			t.Run(side+"/"+strings.ReplaceAll(fault.String(), " ", "_"), func(t *testing.T) {
+				s := glesystest.NewServer()
+				defer s.Close()
+				s.AddZone("example.com", setRecordsInitial...)
+				initial := zoneState(s, "example.com")
+				p := s.Provider()
+				if side == "server" {
+					s.Inject(fault)
+				} else {
+					p.Use(glesystest.NewInjector(fault).Middleware)
+				}
+				ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+				defer cancel()
+
+				got, err := p.SetRecords(ctx, "example.com", setRecordsInput)
+
+				state := zoneState(s, "example.com")
+				if err == nil {
+					t.Errorf("Expected an error from the injected fault")
+					if !reflect.DeepEqual(state, applied) {
+						t.Errorf("Zone is not fully applied. Got %v, want %v", state, applied)
+					}
+					return
+				}
+				if got != nil {
+					t.Errorf("Expected no records on error. Got %v", got)
+				}
+				if !reflect.DeepEqual(state, initial) {
+					t.Errorf("Zone is not fully restored after %v. Got %v, want %v", err, state, initial)
+				}
+			})
+		}
+	}
+}
+
+func TestProvider_SetRecordsRollbackFailure(t *testing.T) {
+	s := glesystest.NewServer()
+	defer s.Close()
+	s.AddZone("example.com", setRecordsInitial...)
+	// fail the delete and then the rollback of the first addition
+	s.Inject(
+		glesystest.Fault{Endpoint: "domain/deleterecord", Nth: 1, Kind: glesystest.FaultError},
+		glesystest.Fault{Endpoint: "domain/deleterecord", Nth: 3, Kind: glesystest.FaultError},
+	)
+
+	_, err := s.Provider().SetRecords(context.Background(), "example.com", setRecordsInput)
+
+	if err == nil || !strings.Contains(err.Error(), "failed to revert") {
+		t.Errorf("Expected rollback failure to be reported. Got %v", err)
+	}
+}
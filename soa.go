@@ -0,0 +1,186 @@
+// SPDX-FileCopyrightText: 2024 Peter Magnusson <me@kmpm.se>
+// SPDX-License-Identifier: MIT
+
+package glesys
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/libdns/glesys/internal/impl"
+)
+
+// SOA holds the SOA values of a zone that GleSYS lets you change.
+// TTL is the default TTL of records added without one.
+type SOA struct {
+	PrimaryNameServer string
+	ResponsiblePerson string
+	TTL               time.Duration
+	Refresh           time.Duration
+	Retry             time.Duration
+	Expire            time.Duration
+	Minimum           time.Duration
+}
+
+// Recommended SOA timer ranges. Refresh, retry and expire follow
+// RFC 1912 section 2.2. Minimum is the negative caching TTL since
+// RFC 2308, which recommends at most a few hours.
+const (
+	minRefresh = 20 * time.Minute
+	maxRefresh = 12 * time.Hour
+	minExpire  = 14 * 24 * time.Hour
+	maxExpire  = 28 * 24 * time.Hour
+	maxMinimum = 3 * time.Hour
+	maxTTL     = (1<<31 - 1) * time.Second
+)
+
+// Validate checks the SOA values against the RFC 1912 recommendations.
+// Zero values are not checked, nor are relations involving them.
+func (s SOA) Validate() error {
+	var errs []error
+	check := func(name string, v, min, max time.Duration) {
+		if v != 0 && (v < min || v > max) {
+			errs = append(errs, fmt.Errorf("%s %v is outside the recommended range %v to %v", name, v, min, max))
+		}
+	}
+	check("refresh", s.Refresh, minRefresh, maxRefresh)
+	check("expire", s.Expire, minExpire, maxExpire)
+	check("minimum", s.Minimum, time.Second, maxMinimum)
+	check("ttl", s.TTL, time.Second, maxTTL)
+	if s.Retry < 0 {
+		errs = append(errs, fmt.Errorf("retry %v is negative", s.Retry))
+	}
+	if s.Retry != 0 && s.Refresh != 0 && s.Retry >= s.Refresh {
+		errs = append(errs, fmt.Errorf("retry %v should be less than refresh %v", s.Retry, s.Refresh))
+	}
+	if s.Expire != 0 && s.Refresh != 0 && s.Expire <= s.Refresh+s.Retry {
+		errs = append(errs, fmt.Errorf("expire %v should be greater than refresh and retry", s.Expire))
+	}
+	if strings.Contains(s.ResponsiblePerson, "@") {
+		errs = append(errs, fmt.Errorf("responsible person %q must be a domain name, use a dot instead of @", s.ResponsiblePerson))
+	}
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("invalid SOA: %w", err)
+	}
+	return nil
+}
+
+// merge returns s with the zero values taken from current.
+func (s SOA) merge(current SOA) SOA {
+	if s.PrimaryNameServer == "" {
+		s.PrimaryNameServer = current.PrimaryNameServer
+	}
+	if s.ResponsiblePerson == "" {
+		s.ResponsiblePerson = current.ResponsiblePerson
+	}
+	if s.TTL == 0 {
+		s.TTL = current.TTL
+	}
+	if s.Refresh == 0 {
+		s.Refresh = current.Refresh
+	}
+	if s.Retry == 0 {
+		s.Retry = current.Retry
+	}
+	if s.Expire == 0 {
+		s.Expire = current.Expire
+	}
+	if s.Minimum == 0 {
+		s.Minimum = current.Minimum
+	}
+	return s
+}
+
+// diff describes the values that differ between s and to, e.g.
+// "retry 1h0m0s -> 45m0s".
+func (s SOA) diff(to SOA) []string {
+	changes := []string{}
+	add := func(name string, from, to any) {
+		if from != to {
+			changes = append(changes, fmt.Sprintf("%s %v -> %v", name, from, to))
+		}
+	}
+	add("primary name server", s.PrimaryNameServer, to.PrimaryNameServer)
+	add("responsible person", s.ResponsiblePerson, to.ResponsiblePerson)
+	add("ttl", s.TTL, to.TTL)
+	add("refresh", s.Refresh, to.Refresh)
+	add("retry", s.Retry, to.Retry)
+	add("expire", s.Expire, to.Expire)
+	add("minimum", s.Minimum, to.Minimum)
+	return changes
+}
+
+// editParams returns the domain/edit parameters setting s on zone.
+func (s SOA) editParams(zone string) impl.EditDNSDomainParams {
+	return impl.EditDNSDomainParams{
+		Name:              zone,
+		PrimaryNameServer: s.PrimaryNameServer,
+		ResponsiblePerson: s.ResponsiblePerson,
+		TTL:               int(s.TTL / time.Second),
+		Refresh:           int(s.Refresh / time.Second),
+		Retry:             int(s.Retry / time.Second),
+		Expire:            int(s.Expire / time.Second),
+		Minimum:           int(s.Minimum / time.Second),
+	}
+}
+
+// toSOA returns the SOA values of a GleSYS DNSDomain.
+func toSOA(d *impl.DNSDomain) SOA {
+	return SOA{
+		PrimaryNameServer: d.PrimaryNameServer,
+		ResponsiblePerson: d.ResponsiblePerson,
+		TTL:               time.Duration(d.TTL) * time.Second,
+		Refresh:           time.Duration(d.Refresh) * time.Second,
+		Retry:             time.Duration(d.Retry) * time.Second,
+		Expire:            time.Duration(d.Expire) * time.Second,
+		Minimum:           time.Duration(d.Minimum) * time.Second,
+	}
+}
+
+// GetSOA returns the SOA values of the zone.
+func (p *Provider) GetSOA(ctx context.Context, zone string) (*SOA, error) {
+	ctx, span := p.startSpan(ctx, "GetSOA", zone, nil)
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	z, err := p.zoneDetails(ctx, zone)
+	endSpan(span, nil, err)
+	if err != nil {
+		return nil, err
+	}
+	return &z.SOA, nil
+}
+
+// SetSOA changes the SOA values of the zone. Zero values in soa keep the
+// current value. The resulting values are validated with SOA.Validate
+// before anything is changed. It returns the updated zone.
+func (p *Provider) SetSOA(ctx context.Context, zone string, soa SOA) (*Zone, error) {
+	ctx, span := p.startSpan(ctx, "SetSOA", zone, nil)
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	z, err := p.setSOA(ctx, zone, soa)
+	endSpan(span, nil, err)
+	return z, err
+}
+
+func (p *Provider) setSOA(ctx context.Context, zone string, soa SOA) (*Zone, error) {
+	zone = cleanZ(zone)
+	if debug {
+		log.Printf("SetSOA zone=%s soa=%+v", zone, soa)
+	}
+	current, err := p.zoneDetails(ctx, zone)
+	if err != nil {
+		return nil, err
+	}
+	if err := soa.merge(current.SOA).Validate(); err != nil {
+		return nil, err
+	}
+	d, err := p.client().DNSDomains.Edit(ctx, soa.editParams(zone))
+	if err != nil {
+		return nil, err
+	}
+	return toZone(d), nil
+}
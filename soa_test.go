@@ -0,0 +1,115 @@
+// SPDX-FileCopyrightText: 2024 Peter Magnusson <me@kmpm.se>
+// SPDX-License-Identifier: MIT
+
+package glesys_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/libdns/glesys"
+	"github.com/libdns/glesys/glesystest"
+)
+
+func TestSOA_Validate(t *testing.T) {
+	day := 24 * time.Hour
+	tests := []struct {
+		name    string
+		soa     glesys.SOA
+		wantErr string
+	}{
+		{"empty", glesys.SOA{}, ""},
+		{"glesys_defaults", glesys.SOA{TTL: time.Hour, Refresh: 3 * time.Hour, Retry: 45 * time.Minute, Expire: 21 * day, Minimum: 3 * time.Hour}, ""},
+		{"refresh_too_short", glesys.SOA{Refresh: 5 * time.Minute}, "refresh 5m0s is outside"},
+		{"refresh_too_long", glesys.SOA{Refresh: day}, "refresh 24h0m0s is outside"},
+		{"retry_not_less_than_refresh", glesys.SOA{Refresh: time.Hour, Retry: time.Hour}, "retry 1h0m0s should be less than refresh"},
+		{"retry_negative", glesys.SOA{Retry: -time.Second}, "retry -1s is negative"},
+		{"expire_too_short", glesys.SOA{Expire: 7 * day}, "expire 168h0m0s is outside"},
+		{"expire_too_long", glesys.SOA{Expire: 60 * day}, "expire 1440h0m0s is outside"},
+		{"minimum_too_long", glesys.SOA{Minimum: day}, "minimum 24h0m0s is outside"},
+		{"ttl_negative", glesys.SOA{TTL: -time.Hour}, "ttl -1h0m0s is outside"},
+		{"responsible_person_email", glesys.SOA{ResponsiblePerson: "hostmaster@example.com"}, "use a dot instead of @"},
+		{"all_errors_reported", glesys.SOA{Refresh: time.Minute, Minimum: day}, "minimum"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.soa.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Validate() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Validate() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestProvider_GetSOA(t *testing.T) {
+	s := glesystest.NewServer()
+	defer s.Close()
+	s.AddZone("example.com")
+
+	got, err := s.Provider().GetSOA(context.Background(), "example.com.")
+
+	if err != nil {
+		t.Fatalf("GetSOA() error = %v", err)
+	}
+	want := glesys.SOA{
+		PrimaryNameServer: "ns1.namesystem.se.",
+		ResponsiblePerson: "registry.glesys.se.",
+		TTL:               time.Hour,
+		Refresh:           3 * time.Hour,
+		Retry:             45 * time.Minute,
+		Expire:            21 * 24 * time.Hour,
+		Minimum:           3 * time.Hour,
+	}
+	if *got != want {
+		t.Errorf("GetSOA() = %+v, want %+v", *got, want)
+	}
+}
+
+func TestProvider_SetSOA(t *testing.T) {
+	s := glesystest.NewServer()
+	defer s.Close()
+	s.AddZone("example.com")
+	p := s.Provider()
+	ctx := context.Background()
+
+	z, err := p.SetSOA(ctx, "example.com", glesys.SOA{Retry: 30 * time.Minute, ResponsiblePerson: "hostmaster.example.com."})
+
+	if err != nil {
+		t.Fatalf("SetSOA() error = %v", err)
+	}
+	if z.Retry != 30*time.Minute || z.ResponsiblePerson != "hostmaster.example.com." || z.Refresh != 3*time.Hour {
+		t.Errorf("SetSOA() = %+v", z.SOA)
+	}
+	got, err := p.GetSOA(ctx, "example.com")
+	if err != nil {
+		t.Fatalf("GetSOA() error = %v", err)
+	}
+	if *got != z.SOA {
+		t.Errorf("GetSOA() = %+v, want %+v", *got, z.SOA)
+	}
+}
+
+func TestProvider_SetSOAInvalid(t *testing.T) {
+	s := glesystest.NewServer()
+	defer s.Close()
+	s.AddZone("example.com")
+	counter := s.Inject()
+
+	// a retry longer than the current refresh of 3h
+	_, err := s.Provider().SetSOA(context.Background(), "example.com", glesys.SOA{Retry: 4 * time.Hour})
+
+	if err == nil || !strings.Contains(err.Error(), "should be less than refresh") {
+		t.Errorf("SetSOA() error = %v", err)
+	}
+	if n := counter.Count("domain/edit"); n != 0 {
+		t.Errorf("SetSOA() with invalid values made %d domain/edit calls", n)
+	}
+}
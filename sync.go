@@ -0,0 +1,251 @@
+// SPDX-FileCopyrightText: 2024 Peter Magnusson <me@kmpm.se>
+// SPDX-License-Identifier: MIT
+
+package glesys
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+
+	"github.com/libdns/glesys/internal/impl"
+	"github.com/libdns/libdns"
+)
+
+// ErrTooManyDeletions is returned when a sync would delete more records
+// than Provider.MaxDeletions allows.
+var ErrTooManyDeletions = errors.New("too many deletions")
+
+// SyncMode decides what happens to records that are not in the source.
+type SyncMode int
+
+const (
+	// SyncMerge replaces the RRsets that are in the source and keeps the
+	// other records of the zone.
+	SyncMerge SyncMode = iota
+	// SyncAuthoritative makes the zone an exact copy of the source,
+	// deleting the RRsets that are not in it.
+	SyncAuthoritative
+)
+
+func (m SyncMode) String() string {
+	switch m {
+	case SyncMerge:
+		return "merge"
+	case SyncAuthoritative:
+		return "authoritative"
+	default:
+		return fmt.Sprintf("SyncMode(%d)", int(m))
+	}
+}
+
+// SyncOptions are the options for Sync.
+type SyncOptions struct {
+	Mode SyncMode
+	// DryRun computes the report without changing anything.
+	DryRun bool
+	// CopyProtected also copies the NS records at the apex and the SOA
+	// records of the source. They are left out by default, so that the
+	// zone stays delegated to the GleSYS name servers.
+	CopyProtected bool
+}
+
+// RecordChange is a record changed from one value to another.
+type RecordChange struct {
+	From libdns.Record
+	To   libdns.Record
+}
+
+// SyncReport summarizes the changes a Sync made, or would make with DryRun.
+type SyncReport struct {
+	Zone      string
+	Mode      SyncMode
+	DryRun    bool
+	Added     []libdns.Record
+	Updated   []RecordChange
+	Deleted   []libdns.Record
+	Unchanged int
+}
+
+// String summarizes the report on one line.
+func (r *SyncReport) String() string {
+	dry := ""
+	if r.DryRun {
+		dry = " (dry run)"
+	}
+	return fmt.Sprintf("%s %s sync%s: %d added, %d updated, %d deleted, %d unchanged",
+		r.Zone, r.Mode, dry, len(r.Added), len(r.Updated), len(r.Deleted), r.Unchanged)
+}
+
+// newSyncReport converts a change set to a report.
+func newSyncReport(zone string, opts SyncOptions, cs changeSet) *SyncReport {
+	r := &SyncReport{
+		Zone:      zone,
+		Mode:      opts.Mode,
+		DryRun:    opts.DryRun,
+		Added:     []libdns.Record{},
+		Updated:   []RecordChange{},
+		Deleted:   []libdns.Record{},
+		Unchanged: len(cs.unchanged),
+	}
+	for _, dr := range cs.additions {
+		r.Added = append(r.Added, toLibDNSOrRR(&dr))
+	}
+	for _, u := range cs.updates {
+		r.Updated = append(r.Updated, RecordChange{From: toLibDNSOrRR(&u.From), To: toLibDNSOrRR(&u.To)})
+	}
+	for _, dr := range cs.deletes {
+		r.Deleted = append(r.Deleted, toLibDNSOrRR(&dr))
+	}
+	return r
+}
+
+// Sync copies the records of srcZone from any libdns provider into zone.
+// The NS records at the apex and the SOA records of the source are left
+// out unless opts.CopyProtected is set. If the zone names differ, targets
+// inside srcZone are rewritten like Clone does. The changes are applied
+// like SetRecords, so a failed sync is rolled back.
+func (p *Provider) Sync(ctx context.Context, src libdns.RecordGetter, srcZone, zone string, opts SyncOptions) (*SyncReport, error) {
+	records, err := src.GetRecords(ctx, srcZone)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", srcZone, err)
+	}
+	if !opts.CopyProtected {
+		records = slices.DeleteFunc(slices.Clone(records), func(r libdns.Record) bool {
+			rr := r.RR()
+			return protected(impl.DNSDomainRecord{Host: rr.Name, Type: rr.Type})
+		})
+	}
+	if cleanZ(srcZone) != cleanZ(zone) {
+		rewritten := make([]libdns.Record, len(records))
+		for i, r := range records {
+			rewritten[i] = rewriteRecord(r, srcZone, zone)
+		}
+		records = rewritten
+	}
+	ctx, span := p.startSpan(ctx, "Sync", zone, records)
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	report, err := p.sync(ctx, zone, records, opts)
+	endSpan(span, nil, err)
+	return report, err
+}
+
+func (p *Provider) sync(ctx context.Context, zone string, records []libdns.Record, opts SyncOptions) (*SyncReport, error) {
+	zone = cleanZ(zone)
+	if debug {
+		log.Printf("Sync zone=%s mode=%s dryrun=%v", zone, opts.Mode, opts.DryRun)
+	}
+	existing, err := p.client().DNSDomains.ListRecords(ctx, zone)
+	if err != nil {
+		return nil, err
+	}
+	var cs changeSet
+	switch opts.Mode {
+	case SyncMerge:
+		cs = planSetRecords(zone, *existing, records)
+	case SyncAuthoritative:
+		cs, _ = planAuthoritative(zone, *existing, records)
+	default:
+		return nil, fmt.Errorf("unknown sync mode %s", opts.Mode)
+	}
+	return p.applySync(ctx, zone, cs, opts)
+}
+
+// applySync checks the deletions against MaxDeletions and applies cs
+// unless it is a dry run.
+func (p *Provider) applySync(ctx context.Context, zone string, cs changeSet, opts SyncOptions) (*SyncReport, error) {
+	if err := p.checkDeletions(zone, cs); err != nil {
+		return nil, err
+	}
+	if opts.DryRun {
+		return newSyncReport(zone, opts, cs), nil
+	}
+	done, err := p.applyChanges(ctx, zone, cs)
+	if err != nil {
+		return nil, err
+	}
+	return newSyncReport(zone, opts, done), nil
+}
+
+// checkDeletions returns ErrTooManyDeletions if cs deletes more than
+// MaxDeletions records.
+func (p *Provider) checkDeletions(zone string, cs changeSet) error {
+	if p.MaxDeletions > 0 && len(cs.deletes) > p.MaxDeletions {
+		return fmt.Errorf("%w: %d records would be deleted from %s, the limit is %d", ErrTooManyDeletions, len(cs.deletes), zone, p.MaxDeletions)
+	}
+	return nil
+}
+
+// protected returns true for records an authoritative sync leaves alone
+// unless the desired records have the same RRset: the NS records at the
+// apex that delegate the zone to GleSYS, and SOA records.
+func protected(dr impl.DNSDomainRecord) bool {
+	typ := strings.ToUpper(dr.Type)
+	return typ == "SOA" || (typ == "NS" && dr.Host == "@")
+}
+
+// kept returns true for the protected records that an authoritative sync
+// to records with the RRsets in rrsets leaves alone.
+func kept(dr impl.DNSDomainRecord, rrsets map[string]bool) bool {
+	return protected(dr) && !rrsets[nameTypeKey(dr.Host, dr.Type)]
+}
+
+// SyncZone makes the zone equal to the desired records, like Sync with
+// SyncAuthoritative does for another provider. Records that match no
+// desired record are deleted, except the protected apex NS and SOA
+// records when desired has no such RRset. If more than MaxDeletions
+// records would be deleted, nothing is changed and ErrTooManyDeletions
+// is returned.
+func (p *Provider) SyncZone(ctx context.Context, zone string, desired []libdns.Record) (*SyncReport, error) {
+	ctx, span := p.startSpan(ctx, "SyncZone", zone, desired)
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	report, err := p.syncZone(ctx, zone, desired)
+	endSpan(span, nil, err)
+	return report, err
+}
+
+func (p *Provider) syncZone(ctx context.Context, zone string, desired []libdns.Record) (*SyncReport, error) {
+	zone = cleanZ(zone)
+	if debug {
+		log.Printf("SyncZone zone=%s", zone)
+	}
+	cs, _, err := p.planSyncZone(ctx, zone, desired)
+	if err != nil {
+		return nil, err
+	}
+	return p.applySync(ctx, zone, cs, SyncOptions{Mode: SyncAuthoritative})
+}
+
+// planSyncZone validates desired and plans the changes that make the
+// zone equal to it with planAuthoritative.
+func (p *Provider) planSyncZone(ctx context.Context, zone string, desired []libdns.Record) (changeSet, []impl.DNSDomainRecord, error) {
+	for _, r := range desired {
+		if rr := r.RR(); rr.Name == "" || rr.Type == "" || rr.Data == "" {
+			return changeSet{}, nil, fmt.Errorf("invalid desired record %+v: name, type and data are required", rr)
+		}
+	}
+	existing, err := p.client().DNSDomains.ListRecords(ctx, zone)
+	if err != nil {
+		return changeSet{}, nil, err
+	}
+	cs, managed := planAuthoritative(zone, *existing, desired)
+	return cs, managed, nil
+}
+
+// planAuthoritative returns the changes that make the zone equal to
+// records, leaving the protected records alone unless records has their
+// RRset, and the existing records the changes apply to, which are all but
+// those protected ones.
+func planAuthoritative(zone string, existing []impl.DNSDomainRecord, records []libdns.Record) (changeSet, []impl.DNSDomainRecord) {
+	rrsets := rrsetKeys(records)
+	isKept := func(dr impl.DNSDomainRecord) bool { return kept(dr, rrsets) }
+	cs := planZone(zone, existing, records)
+	cs.deletes = slices.DeleteFunc(cs.deletes, isKept)
+	managed := slices.DeleteFunc(slices.Clone(existing), isKept)
+	return cs, managed
+}
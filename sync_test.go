@@ -0,0 +1,287 @@
+// SPDX-FileCopyrightText: 2024 Peter Magnusson <me@kmpm.se>
+// SPDX-License-Identifier: MIT
+
+package glesys_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/libdns/glesys"
+	"github.com/libdns/glesys/glesystest"
+	"github.com/libdns/libdns"
+)
+
+// staticSource is a libdns.RecordGetter standing in for another provider.
+type staticSource map[string][]libdns.Record
+
+func (s staticSource) GetRecords(ctx context.Context, zone string) ([]libdns.Record, error) {
+	return s[zone], nil
+}
+
+var syncTarget = []libdns.Record{
+	addr("www", "192.0.2.1"),
+	addr("www", "192.0.2.2"),
+	libdns.TXT{Name: "@", TTL: time.Hour, Text: "old"},
+	libdns.TXT{Name: "keep", TTL: time.Hour, Text: "local"},
+}
+
+var syncSource = staticSource{"example.org.": {
+	addr("www", "192.0.2.1"),
+	libdns.TXT{Name: "@", TTL: time.Hour, Text: "new"},
+	libdns.CNAME{Name: "shop", TTL: time.Hour, Target: "www.example.org."},
+}}
+
+func TestProvider_Sync(t *testing.T) {
+	tests := []struct {
+		name        string
+		opts        glesys.SyncOptions
+		wantSummary string
+		want        []libdns.Record
+	}{
+		{"merge", glesys.SyncOptions{Mode: glesys.SyncMerge},
+			"example.com merge sync: 1 added, 1 updated, 1 deleted, 1 unchanged",
+			[]libdns.Record{
+				addr("www", "192.0.2.1"),
+				libdns.TXT{Name: "@", TTL: time.Hour, Text: "new"},
+				libdns.TXT{Name: "keep", TTL: time.Hour, Text: "local"},
+				libdns.CNAME{Name: "shop", TTL: time.Hour, Target: "www.example.com."},
+			}},
+		{"authoritative", glesys.SyncOptions{Mode: glesys.SyncAuthoritative},
+			"example.com authoritative sync: 1 added, 1 updated, 2 deleted, 1 unchanged",
+			[]libdns.Record{
+				addr("www", "192.0.2.1"),
+				libdns.TXT{Name: "@", TTL: time.Hour, Text: "new"},
+				libdns.CNAME{Name: "shop", TTL: time.Hour, Target: "www.example.com."},
+			}},
+		{"dry_run", glesys.SyncOptions{Mode: glesys.SyncAuthoritative, DryRun: true},
+			"example.com authoritative sync (dry run): 1 added, 1 updated, 2 deleted, 1 unchanged",
+			syncTarget},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := glesystest.NewServer()
+			defer s.Close()
+			s.AddZone("example.com", syncTarget...)
+			p := s.Provider()
+
+			report, err := p.Sync(context.Background(), syncSource, "example.org.", "example.com", tt.opts)
+
+			if err != nil {
+				t.Fatalf("Sync() error = %v", err)
+			}
+			if got := report.String(); got != tt.wantSummary {
+				t.Errorf("Sync() = %q, want %q", got, tt.wantSummary)
+			}
+			assertZone(t, s, tt.want...)
+		})
+	}
+}
+
+func TestProvider_SyncReport(t *testing.T) {
+	s := glesystest.NewServer()
+	defer s.Close()
+	s.AddZone("example.com", syncTarget...)
+
+	report, err := s.Provider().Sync(context.Background(), syncSource, "example.org.", "example.com", glesys.SyncOptions{Mode: glesys.SyncAuthoritative, DryRun: true})
+
+	if err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	assertRecords(t, "Added", report.Added, libdns.CNAME{Name: "shop", TTL: time.Hour, Target: "www.example.com."})
+	assertRecords(t, "Deleted", report.Deleted, addr("www", "192.0.2.2"), libdns.TXT{Name: "keep", TTL: time.Hour, Text: "local"})
+	wantUpdated := []glesys.RecordChange{{
+		From: libdns.TXT{Name: "@", TTL: time.Hour, Text: "old"},
+		To:   libdns.TXT{Name: "@", TTL: time.Hour, Text: "new"},
+	}}
+	if !reflect.DeepEqual(report.Updated, wantUpdated) {
+		t.Errorf("Updated = %v, want %v", report.Updated, wantUpdated)
+	}
+}
+
+func TestProvider_SyncFromProvider(t *testing.T) {
+	src := glesystest.NewServer()
+	defer src.Close()
+	src.AddZone("example.com", cloneSource...)
+	dst := glesystest.NewServer()
+	defer dst.Close()
+	dst.AddZone("example.com", addr("old", "192.0.2.9"))
+	p := dst.Provider()
+	ctx := context.Background()
+
+	if _, err := p.Sync(ctx, src.Provider(), "example.com", "example.com", glesys.SyncOptions{Mode: glesys.SyncAuthoritative}); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	if got, want := zoneState(dst, "example.com"), zoneState(src, "example.com"); !reflect.DeepEqual(got, want) {
+		t.Errorf("Zone is %v, want %v", got, want)
+	}
+	again, err := p.Sync(ctx, src.Provider(), "example.com", "example.com", glesys.SyncOptions{Mode: glesys.SyncAuthoritative})
+	if err != nil {
+		t.Fatalf("repeated Sync() error = %v", err)
+	}
+	if len(again.Added)+len(again.Updated)+len(again.Deleted) != 0 {
+		t.Errorf("Repeated Sync() made changes: %v", again)
+	}
+}
+
+var syncZoneInitial = []libdns.Record{
+	libdns.NS{Name: "@", TTL: time.Hour, Target: "ns1.namesystem.se."},
+	libdns.NS{Name: "@", TTL: time.Hour, Target: "ns2.namesystem.se."},
+	addr("www", "192.0.2.1"),
+	addr("www", "192.0.2.2"),
+	libdns.TXT{Name: "stale", TTL: time.Hour, Text: "a"},
+	libdns.TXT{Name: "stale", TTL: time.Hour, Text: "b"},
+	libdns.MX{Name: "@", TTL: time.Hour, Preference: 10, Target: "mail.example.com."},
+}
+
+func TestProvider_SyncZone(t *testing.T) {
+	tests := []struct {
+		name    string
+		desired []libdns.Record
+		want    []libdns.Record
+	}{
+		{"prunes_extras_keeps_apex_ns",
+			[]libdns.Record{addr("www", "192.0.2.1"), addr("api", "192.0.2.3")},
+			[]libdns.Record{
+				libdns.NS{Name: "@", TTL: time.Hour, Target: "ns1.namesystem.se."},
+				libdns.NS{Name: "@", TTL: time.Hour, Target: "ns2.namesystem.se."},
+				addr("www", "192.0.2.1"),
+				addr("api", "192.0.2.3"),
+			}},
+		{"desired_apex_ns_is_managed",
+			[]libdns.Record{
+				libdns.NS{Name: "@", TTL: time.Hour, Target: "ns1.namesystem.se."},
+				libdns.NS{Name: "@", TTL: time.Hour, Target: "ns3.namesystem.se."},
+			},
+			[]libdns.Record{
+				libdns.NS{Name: "@", TTL: time.Hour, Target: "ns1.namesystem.se."},
+				libdns.NS{Name: "@", TTL: time.Hour, Target: "ns3.namesystem.se."},
+			}},
+		{"subdomain_ns_is_not_protected",
+			append(syncZoneInitial[:6:6], libdns.NS{Name: "sub", TTL: time.Hour, Target: "ns.example.net."}),
+			append(syncZoneInitial[:6:6], libdns.NS{Name: "sub", TTL: time.Hour, Target: "ns.example.net."}),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := glesystest.NewServer()
+			defer s.Close()
+			s.AddZone("example.com", syncZoneInitial...)
+			p := s.Provider()
+			ctx := context.Background()
+
+			if _, err := p.SyncZone(ctx, "example.com.", tt.desired); err != nil {
+				t.Fatalf("SyncZone() error = %v", err)
+			}
+			assertZone(t, s, tt.want...)
+
+			again, err := p.SyncZone(ctx, "example.com", tt.desired)
+			if err != nil {
+				t.Fatalf("repeated SyncZone() error = %v", err)
+			}
+			if len(again.Added)+len(again.Updated)+len(again.Deleted) != 0 {
+				t.Errorf("Repeated SyncZone() made changes: %v", again)
+			}
+		})
+	}
+}
+
+func TestProvider_SyncZoneMaxDeletions(t *testing.T) {
+	s := glesystest.NewServer()
+	defer s.Close()
+	s.AddZone("example.com", syncZoneInitial...)
+	p := s.Provider()
+	p.MaxDeletions = 3
+	counter := s.Inject()
+	before := zoneState(s, "example.com")
+
+	// www 192.0.2.2, both stale TXT and the MX would go
+	_, err := p.SyncZone(context.Background(), "example.com", []libdns.Record{addr("www", "192.0.2.1")})
+
+	if !errors.Is(err, glesys.ErrTooManyDeletions) {
+		t.Errorf("SyncZone() error = %v, want ErrTooManyDeletions", err)
+	}
+	for _, endpoint := range mutatingEndpoints {
+		if n := counter.Count(endpoint); n != 0 {
+			t.Errorf("SyncZone() over the limit made %d %s calls", n, endpoint)
+		}
+	}
+	if after := zoneState(s, "example.com"); !reflect.DeepEqual(after, before) {
+		t.Errorf("Zone changed to %v", after)
+	}
+
+	p.MaxDeletions = 4
+	if _, err := p.SyncZone(context.Background(), "example.com", []libdns.Record{addr("www", "192.0.2.1")}); err != nil {
+		t.Errorf("SyncZone() at the limit error = %v", err)
+	}
+}
+
+func TestProvider_SyncZoneInvalid(t *testing.T) {
+	s := glesystest.NewServer()
+	defer s.Close()
+	s.AddZone("example.com", syncZoneInitial...)
+
+	_, err := s.Provider().SyncZone(context.Background(), "example.com", []libdns.Record{libdns.RR{Name: "www", Type: "A"}})
+
+	if err == nil {
+		t.Errorf("SyncZone() with a record without data did not fail")
+	}
+}
+
+func TestProvider_SyncAuthoritativeKeepsApexNS(t *testing.T) {
+	s := glesystest.NewServer()
+	defer s.Close()
+	s.AddZone("example.com", syncZoneInitial...)
+	source := staticSource{"example.com": {addr("www", "192.0.2.1")}}
+
+	_, err := s.Provider().Sync(context.Background(), source, "example.com", "example.com", glesys.SyncOptions{Mode: glesys.SyncAuthoritative})
+
+	if err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	assertZone(t, s, syncZoneInitial[0], syncZoneInitial[1], addr("www", "192.0.2.1"))
+}
+
+func TestProvider_SyncMigratesZoneWithApexNS(t *testing.T) {
+	// a zone exported from another DNS host has that host's apex NS records
+	source := staticSource{"example.com.": {
+		libdns.NS{Name: "@", TTL: time.Hour, Target: "ns1.otherdns.net."},
+		libdns.NS{Name: "@", TTL: time.Hour, Target: "ns2.otherdns.net."},
+		libdns.RR{Name: "@", TTL: time.Hour, Type: "SOA", Data: "ns1.otherdns.net. hostmaster.example.com. 1 3600 600 86400 300"},
+		libdns.NS{Name: "sub", TTL: time.Hour, Target: "ns1.otherdns.net."},
+		addr("www", "192.0.2.1"),
+	}}
+	migrated := []libdns.Record{
+		libdns.NS{Name: "sub", TTL: time.Hour, Target: "ns1.otherdns.net."},
+		addr("www", "192.0.2.1"),
+	}
+	tests := []struct {
+		name string
+		opts glesys.SyncOptions
+		want []libdns.Record
+	}{
+		{"merge", glesys.SyncOptions{Mode: glesys.SyncMerge},
+			append(syncZoneInitial[:2:2], migrated...)},
+		{"authoritative", glesys.SyncOptions{Mode: glesys.SyncAuthoritative},
+			append(syncZoneInitial[:2:2], migrated...)},
+		{"copy_protected", glesys.SyncOptions{Mode: glesys.SyncAuthoritative, CopyProtected: true},
+			append(source["example.com."][:3:3], migrated...)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := glesystest.NewServer()
+			defer s.Close()
+			s.AddZone("example.com", syncZoneInitial[:2]...)
+
+			_, err := s.Provider().Sync(context.Background(), source, "example.com.", "example.com", tt.opts)
+
+			if err != nil {
+				t.Fatalf("Sync() error = %v", err)
+			}
+			assertZone(t, s, tt.want...)
+		})
+	}
+}
@@ -5,11 +5,63 @@ package glesys
 
 import (
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"testing"
+
+	"github.com/libdns/glesys/internal/cassette"
 )
 
+// cassetteZone is the zone name used in recorded cassettes.
+// The real zone is scrubbed to this name when recording.
+const cassetteZone = "example.com"
+
 func skipUnauth(t *testing.T) {
 	if len(os.Getenv("GLESYS_PROJECT")) < 6 || len(os.Getenv("GLESYS_KEY")) < 10 || len(os.Getenv("GLESYS_ZONE")) < 4 {
 		t.Skip("Skipping testing because missing credentials")
 	}
 }
+
+// cassetteProvider returns a Provider and zone for integration tests.
+// By default the API interactions are replayed from testdata/cassettes.
+// If GLESYS_RECORD is true they are instead recorded from the real API
+// using the GLESYS_PROJECT, GLESYS_KEY and GLESYS_ZONE credentials.
+func cassetteProvider(t *testing.T) (*Provider, string) {
+	t.Helper()
+	name := filepath.Join("testdata", "cassettes", strings.ReplaceAll(t.Name(), "/", "_")+".json")
+	if record, _ := strconv.ParseBool(os.Getenv("GLESYS_RECORD")); record {
+		skipUnauth(t)
+		rec, err := cassette.New(name, cassette.ModeRecord)
+		if err != nil {
+			t.Fatal(err)
+		}
+		zone := cleanZ(os.Getenv("GLESYS_ZONE"))
+		rec.Scrub(zone, cassetteZone)
+		t.Cleanup(func() {
+			if err := rec.Stop(); err != nil {
+				t.Error(err)
+			}
+		})
+		return &Provider{
+			Project:    os.Getenv("GLESYS_PROJECT"),
+			APIKey:     os.Getenv("GLESYS_KEY"),
+			HTTPClient: rec.Client(),
+		}, zone
+	}
+
+	rec, err := cassette.New(name, cassette.ModeReplay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := rec.Stop(); err != nil {
+			t.Error(err)
+		}
+	})
+	return &Provider{
+		Project:    "cl12345",
+		APIKey:     "replay",
+		HTTPClient: rec.Client(),
+	}, cassetteZone
+}
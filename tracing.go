@@ -0,0 +1,73 @@
+// SPDX-FileCopyrightText: 2024 Peter Magnusson <me@kmpm.se>
+// SPDX-License-Identifier: MIT
+
+package glesys
+
+import (
+	"context"
+
+	"github.com/libdns/libdns"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+const tracerName = "github.com/libdns/glesys"
+
+// tracer returns the tracer to use for spans, which is a no-op
+// tracer if no TracerProvider has been configured.
+func (p *Provider) tracer() trace.Tracer {
+	if p.TracerProvider == nil {
+		return noop.NewTracerProvider().Tracer(tracerName)
+	}
+	return p.TracerProvider.Tracer(tracerName)
+}
+
+// startSpan starts a span for a Provider method.
+func (p *Provider) startSpan(ctx context.Context, method, zone string, records []libdns.Record) (context.Context, trace.Span) {
+	return p.tracer().Start(ctx, "glesys."+method,
+		trace.WithAttributes(
+			attribute.String("glesys.zone", cleanZ(zone)),
+			attribute.Int("glesys.records", len(records)),
+		),
+	)
+}
+
+// endSpan records the outcome of a Provider method and ends the span.
+func endSpan(span trace.Span, results []libdns.Record, err error) {
+	span.SetAttributes(attribute.Int("glesys.result_records", len(results)))
+	if err != nil {
+		span.SetAttributes(attribute.String("glesys.outcome", "error"))
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	} else {
+		span.SetAttributes(attribute.String("glesys.outcome", "ok"))
+	}
+	span.End()
+}
+
+// tracingMiddleware creates a child span for every GleSYS API call.
+func (p *Provider) tracingMiddleware(next Handler) Handler {
+	return func(call *Call) error {
+		ctx, span := p.tracer().Start(call.Request.Context(), call.Path,
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(
+				attribute.String("glesys.endpoint", call.Path),
+				attribute.String("http.request.method", call.Method),
+			),
+		)
+		defer span.End()
+		call.Request = call.Request.WithContext(ctx)
+
+		err := next(call)
+		if call.Response != nil {
+			span.SetAttributes(attribute.Int("http.response.status_code", call.Response.StatusCode))
+		}
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		return err
+	}
+}
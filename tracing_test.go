@@ -0,0 +1,79 @@
+// SPDX-FileCopyrightText: 2024 Peter Magnusson <me@kmpm.se>
+// SPDX-License-Identifier: MIT
+
+package glesys
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func spanAttr(span sdktrace.ReadOnlySpan, key string) attribute.Value {
+	for _, kv := range span.Attributes() {
+		if string(kv.Key) == key {
+			return kv.Value
+		}
+	}
+	return attribute.Value{}
+}
+
+func TestProvider_Tracing(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+
+	tests := []struct {
+		name        string
+		status      int
+		wantOutcome string
+		wantCode    codes.Code
+	}{
+		{"ok", http.StatusOK, "ok", codes.Unset},
+		{"error", http.StatusForbidden, "error", codes.Error},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exporter.Reset()
+			p := newTestProvider(t, func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				w.Write([]byte(listRecordsResponse))
+			})
+			p.TracerProvider = tp
+
+			p.GetRecords(context.TODO(), "example.com.")
+
+			spans := exporter.GetSpans().Snapshots()
+			if len(spans) != 2 {
+				t.Fatalf("Expected 2 spans. Got %v", len(spans))
+			}
+			// child spans end first
+			call, method := spans[0], spans[1]
+			if call.Name() != "domain/listrecords" {
+				t.Errorf("Unexpected call span name %v", call.Name())
+			}
+			if call.Parent().SpanID() != method.SpanContext().SpanID() {
+				t.Errorf("Call span is not a child of the method span")
+			}
+			if got := spanAttr(call, "http.response.status_code").AsInt64(); got != int64(tt.status) {
+				t.Errorf("Unexpected status code attribute %v", got)
+			}
+			if method.Name() != "glesys.GetRecords" {
+				t.Errorf("Unexpected method span name %v", method.Name())
+			}
+			if got := spanAttr(method, "glesys.zone").AsString(); got != "example.com" {
+				t.Errorf("Unexpected zone attribute %v", got)
+			}
+			if got := spanAttr(method, "glesys.outcome").AsString(); got != tt.wantOutcome {
+				t.Errorf("Unexpected outcome attribute %v", got)
+			}
+			if method.Status().Code != tt.wantCode {
+				t.Errorf("Unexpected status %v", method.Status())
+			}
+		})
+	}
+}
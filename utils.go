@@ -16,26 +16,39 @@ func cleanZ(z string) string {
 
 // toLibDNS converts a GleSYS DNSDomainRecord to a libdns Record.
 func toLibDNS(dr *impl.DNSDomainRecord) (libdns.Record, error) {
-	r, err := libdns.RR{
-		Type: dr.Type,
-		Name: dr.Host,
-		Data: dr.Data,
-		TTL:  time.Duration(dr.TTL) * time.Second,
-	}.Parse()
+	r, err := toRR(dr).Parse()
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse glesys record: %w", err)
 	}
+	if rr := r.RR(); rr.Type != dr.Type || rr.Name != dr.Host {
+		// e.g. an IPv6 address in an A record would otherwise become AAAA
+		// and a malformed SRV host would change name
+		return nil, fmt.Errorf("failed to parse glesys record: invalid %s record %q with data %q", dr.Type, dr.Host, dr.Data)
+	}
 	return r, nil
 }
 
-func mustToLibDNS(dr *impl.DNSDomainRecord) libdns.Record {
+// toLibDNSOrRR converts a GleSYS DNSDomainRecord like toLibDNS, but falls
+// back to the opaque libdns.RR if the data can not be parsed. Use it where
+// the change has already been made and an error would be misleading.
+func toLibDNSOrRR(dr *impl.DNSDomainRecord) libdns.Record {
 	r, err := toLibDNS(dr)
 	if err != nil {
-		panic(fmt.Sprintf("failed to convert glesys record: %v", err))
+		return toRR(dr)
 	}
 	return r
 }
 
+// toRR converts a GleSYS DNSDomainRecord to an unparsed libdns.RR.
+func toRR(dr *impl.DNSDomainRecord) libdns.RR {
+	return libdns.RR{
+		Type: dr.Type,
+		Name: dr.Host,
+		Data: dr.Data,
+		TTL:  time.Duration(dr.TTL) * time.Second,
+	}
+}
+
 type matchParams struct {
 	Name bool
 	Type bool
@@ -59,9 +72,9 @@ func (mp matchParams) none() bool {
 // It returns a matchParams struct with the results of the comparison.
 // The comparison is done by checking if the fields of the libdns.RR
 // are equal to the corresponding fields of the DNSDomainRecord.
-// If the fields are 'zero' (empty string or zero value), they are considered
-// to checkParamsMatching. This is useful for checking if a record is already present in
-// the DNS provider.
+// A zero field of the libdns.RR (empty string or zero TTL) is a wildcard
+// that matches any value, so the match is not symmetric: it only is when
+// every field of both records is set.
 func checkParamsMatching(rr libdns.RR, dr *impl.DNSDomainRecord) matchParams {
 	return matchParams{
 		Name: rr.Name == "" || rr.Name == dr.Host,
@@ -70,3 +83,64 @@ func checkParamsMatching(rr libdns.RR, dr *impl.DNSDomainRecord) matchParams {
 		TTL:  rr.TTL == 0 || rr.TTL == time.Duration(dr.TTL)*time.Second,
 	}
 }
+
+// recordIndex indexes the records of a zone by name and by name and type,
+// so records can be matched without scanning the whole zone. Lookups
+// return the records in zone order.
+type recordIndex struct {
+	records    []impl.DNSDomainRecord
+	byName     map[string][]int
+	byNameType map[string][]int
+}
+
+func nameTypeKey(name, typ string) string {
+	return name + " " + strings.ToUpper(typ)
+}
+
+func newRecordIndex(records []impl.DNSDomainRecord) *recordIndex {
+	idx := &recordIndex{
+		records:    records,
+		byName:     map[string][]int{},
+		byNameType: map[string][]int{},
+	}
+	for i, dr := range records {
+		idx.byName[dr.Host] = append(idx.byName[dr.Host], i)
+		key := nameTypeKey(dr.Host, dr.Type)
+		idx.byNameType[key] = append(idx.byNameType[key], i)
+	}
+	return idx
+}
+
+// lookup returns the records with the given name and type, ignoring the
+// case of the type.
+func (idx *recordIndex) lookup(name, typ string) []impl.DNSDomainRecord {
+	found := []impl.DNSDomainRecord{}
+	for _, i := range idx.byNameType[nameTypeKey(name, typ)] {
+		found = append(found, idx.records[i])
+	}
+	return found
+}
+
+// match returns the records matching rr as checkParamsMatching does.
+// An empty name or type in rr falls back to a wider scan.
+func (idx *recordIndex) match(rr libdns.RR) []impl.DNSDomainRecord {
+	var candidates []int
+	switch {
+	case rr.Name == "":
+		candidates = make([]int, len(idx.records))
+		for i := range idx.records {
+			candidates[i] = i
+		}
+	case rr.Type == "":
+		candidates = idx.byName[rr.Name]
+	default:
+		candidates = idx.byNameType[nameTypeKey(rr.Name, rr.Type)]
+	}
+	matches := []impl.DNSDomainRecord{}
+	for _, i := range candidates {
+		if checkParamsMatching(rr, &idx.records[i]).all() {
+			matches = append(matches, idx.records[i])
+		}
+	}
+	return matches
+}
@@ -1,8 +1,11 @@
 package glesys
 
 import (
+	"fmt"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/libdns/glesys/internal/impl"
 	"github.com/libdns/libdns"
@@ -60,3 +63,223 @@ func Test_cleanZ(t *testing.T) {
 		})
 	}
 }
+
+// fromRR converts a libdns.RR to a GleSYS DNSDomainRecord the same way
+// the provider does when sending records.
+func fromRR(rr libdns.RR) *impl.DNSDomainRecord {
+	return &impl.DNSDomainRecord{
+		Host: rr.Name,
+		Type: rr.Type,
+		Data: rr.Data,
+		TTL:  int(rr.TTL / time.Second),
+	}
+}
+
+func FuzzCleanZ(f *testing.F) {
+	f.Fuzz(func(t *testing.T, z string) {
+		got := cleanZ(z)
+		if cleanZ(got) != got {
+			t.Errorf("cleanZ(%q) = %q is not stable", z, got)
+		}
+		if strings.HasSuffix(got, ".") || strings.HasSuffix(got, " ") {
+			t.Errorf("cleanZ(%q) = %q has a trailing dot or space", z, got)
+		}
+	})
+}
+
+func FuzzToLibDNS(f *testing.F) {
+	f.Fuzz(func(t *testing.T, host, typ, data string, ttl int) {
+		dr := &impl.DNSDomainRecord{Host: host, Type: typ, Data: data, TTL: ttl}
+		// must never panic, whatever the API returns
+		fallback := toLibDNSOrRR(dr)
+		r, err := toLibDNS(dr)
+		if err != nil {
+			if fallback != toRR(dr) {
+				t.Errorf("toLibDNSOrRR(%+v) = %+v, want the unparsed RR", dr, fallback)
+			}
+			return
+		}
+		rr := r.RR()
+		if rr.Name != host || rr.Type != typ || rr.TTL != time.Duration(ttl)*time.Second {
+			t.Errorf("toLibDNS(%+v) changed name, type or TTL: %+v", dr, rr)
+		}
+		if rr.Data != data {
+			// normalized data, e.g. re-quoted CAA values, is not required to be stable
+			return
+		}
+		again, err := toLibDNS(fromRR(rr))
+		if err != nil {
+			t.Fatalf("toLibDNS(%+v) failed on its own output: %v", rr, err)
+		}
+		if again.RR() != rr {
+			t.Errorf("round trip is not stable. Got %+v, want %+v", again.RR(), rr)
+		}
+	})
+}
+
+func FuzzCheckParamsMatching(f *testing.F) {
+	f.Fuzz(func(t *testing.T, name, typ, data string, ttl int, host, dtype, ddata string, dttl int) {
+		rr := libdns.RR{Name: name, Type: typ, Data: data, TTL: time.Duration(ttl) * time.Second}
+		dr := &impl.DNSDomainRecord{Host: host, Type: dtype, Data: ddata, TTL: dttl}
+
+		if got := checkParamsMatching(toRR(dr), dr); !got.all() {
+			t.Errorf("record does not match itself: %+v", got)
+		}
+		if got := checkParamsMatching(libdns.RR{}, dr); !got.all() {
+			t.Errorf("empty RR does not match everything: %+v", got)
+		}
+		got := checkParamsMatching(rr, dr)
+
+		// with no wildcards, matching rr against dr is the same as matching
+		// dr against rr
+		if name != "" && typ != "" && data != "" && ttl != 0 && host != "" && dtype != "" && ddata != "" && dttl != 0 {
+			back := checkParamsMatching(
+				libdns.RR{Name: host, Type: dtype, Data: ddata, TTL: time.Duration(dttl) * time.Second},
+				&impl.DNSDomainRecord{Host: name, Type: typ, Data: data, TTL: ttl},
+			)
+			if got != back {
+				t.Errorf("match is not symmetric: %+v and back %+v", got, back)
+			}
+		}
+
+		// clearing a field of rr makes it a wildcard, which may only widen
+		// the match on that field and leaves the other fields alone
+		for field, clear := range map[string]func(libdns.RR) libdns.RR{
+			"name": func(r libdns.RR) libdns.RR { r.Name = ""; return r },
+			"type": func(r libdns.RR) libdns.RR { r.Type = ""; return r },
+			"data": func(r libdns.RR) libdns.RR { r.Data = ""; return r },
+			"ttl":  func(r libdns.RR) libdns.RR { r.TTL = 0; return r },
+		} {
+			wide := checkParamsMatching(clear(rr), dr)
+			if cleared := map[string]bool{"name": wide.Name, "type": wide.Type, "data": wide.Data, "ttl": wide.TTL}[field]; !cleared {
+				t.Errorf("cleared %s is not a wildcard: %+v", field, wide)
+			}
+			if got.all() && !wide.all() {
+				t.Errorf("clearing %s narrowed the match: %+v to %+v", field, got, wide)
+			}
+			for _, f := range [][2]bool{{got.Name, wide.Name}, {got.Type, wide.Type}, {got.Data, wide.Data}, {got.TTL, wide.TTL}} {
+				if f[0] && !f[1] {
+					t.Errorf("clearing %s narrowed a field: %+v to %+v", field, got, wide)
+				}
+			}
+		}
+
+		// the index must find exactly what a scan with checkParamsMatching
+		// finds, also among records sharing some fields with rr
+		records := []impl.DNSDomainRecord{
+			*dr,
+			{RecordID: 1, Host: name, Type: dtype, Data: ddata, TTL: dttl},
+			{RecordID: 2, Host: name, Type: typ, Data: ddata, TTL: dttl},
+			{RecordID: 3, Host: name, Type: strings.ToLower(typ), Data: data, TTL: ttl},
+			{RecordID: 4, Host: name, Type: typ, Data: data, TTL: ttl},
+		}
+		want := []impl.DNSDomainRecord{}
+		for _, r := range records {
+			if checkParamsMatching(rr, &r).all() {
+				want = append(want, r)
+			}
+		}
+		if found := newRecordIndex(records).match(rr); !reflect.DeepEqual(found, want) {
+			t.Errorf("index match(%+v) = %v, scan = %v", rr, found, want)
+		}
+	})
+}
+
+func Test_recordIndexMatch(t *testing.T) {
+	records := []impl.DNSDomainRecord{
+		{RecordID: 1, Host: "www", Type: "A", Data: "192.0.2.1", TTL: 3600},
+		{RecordID: 2, Host: "www", Type: "A", Data: "192.0.2.2", TTL: 300},
+		{RecordID: 3, Host: "www", Type: "TXT", Data: "a", TTL: 3600},
+		{RecordID: 4, Host: "@", Type: "A", Data: "192.0.2.1", TTL: 3600},
+		{RecordID: 5, Host: "mail", Type: "mx", Data: "10 mx.example.com.", TTL: 3600},
+	}
+	idx := newRecordIndex(records)
+	for _, rr := range []libdns.RR{
+		{},
+		{Name: "www"},
+		{Name: "www", Type: "A"},
+		{Name: "www", Type: "a"},
+		{Name: "www", Type: "A", Data: "192.0.2.2"},
+		{Name: "www", Type: "A", TTL: time.Hour},
+		{Type: "A", Data: "192.0.2.1"},
+		{Data: "a"},
+		{Name: "mail", Type: "mx"},
+		{Name: "mail", Type: "MX"},
+		{Name: "missing", Type: "A"},
+	} {
+		want := []impl.DNSDomainRecord{}
+		for _, dr := range records {
+			if checkParamsMatching(rr, &dr).all() {
+				want = append(want, dr)
+			}
+		}
+		if got := idx.match(rr); !reflect.DeepEqual(got, want) {
+			t.Errorf("match(%+v) = %v, want %v", rr, got, want)
+		}
+	}
+}
+
+func Test_recordIndexLookup(t *testing.T) {
+	records := []impl.DNSDomainRecord{
+		{RecordID: 1, Host: "www", Type: "a", Data: "192.0.2.1"},
+		{RecordID: 2, Host: "www", Type: "TXT", Data: "a"},
+		{RecordID: 3, Host: "www", Type: "A", Data: "192.0.2.2"},
+	}
+	got := newRecordIndex(records).lookup("www", "A")
+	want := []impl.DNSDomainRecord{records[0], records[2]}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("lookup() = %v, want %v", got, want)
+	}
+}
+
+// benchRecords returns n records spread over n/2 names, an A and a TXT
+// record per name.
+func benchRecords(n int) []impl.DNSDomainRecord {
+	records := make([]impl.DNSDomainRecord, 0, n)
+	for i := range n {
+		dr := impl.DNSDomainRecord{DomainName: "example.com", RecordID: i + 1, Host: fmt.Sprintf("host%d", i/2), TTL: 3600}
+		if i%2 == 0 {
+			dr.Type, dr.Data = "A", fmt.Sprintf("192.0.%d.%d", i/256%256, i%256)
+		} else {
+			dr.Type, dr.Data = "TXT", fmt.Sprintf("record %d", i)
+		}
+		records = append(records, dr)
+	}
+	return records
+}
+
+var benchSizes = []int{10, 100, 1000, 10000}
+
+func Benchmark_planSetRecords(b *testing.B) {
+	for _, n := range benchSizes {
+		b.Run(fmt.Sprintf("records_%d", n), func(b *testing.B) {
+			existing := benchRecords(n)
+			// set every RRset in the zone, half of them to new data
+			input := make([]libdns.Record, len(existing))
+			for i, dr := range existing {
+				rr := toRR(&dr)
+				if i%4 < 2 {
+					rr.Data += "0"
+				}
+				input[i] = rr
+			}
+			for b.Loop() {
+				planSetRecords("example.com", existing, input)
+			}
+		})
+	}
+}
+
+func Benchmark_recordIndexMatch(b *testing.B) {
+	for _, n := range benchSizes {
+		b.Run(fmt.Sprintf("records_%d", n), func(b *testing.B) {
+			existing := benchRecords(n)
+			for b.Loop() {
+				idx := newRecordIndex(existing)
+				for i := range existing {
+					idx.match(toRR(&existing[i]))
+				}
+			}
+		})
+	}
+}
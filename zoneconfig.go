@@ -0,0 +1,386 @@
+// SPDX-FileCopyrightText: 2024 Peter Magnusson <me@kmpm.se>
+// SPDX-License-Identifier: MIT
+
+package glesys
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/libdns/glesys/internal/impl"
+	"github.com/libdns/libdns"
+	"gopkg.in/yaml.v3"
+)
+
+// defaultConfigTTL is the TTL of records in a zone config that give none.
+const defaultConfigTTL = time.Hour
+
+// ErrPlanOutdated is returned by ApplyZonePlan and ApplyRestore when the
+// zone has changed since the plan was made.
+var ErrPlanOutdated = errors.New("zone changed since the plan was made")
+
+// ZoneConfig is a zone definition read by LoadZoneConfig.
+//
+// The definition is a YAML or JSON file with the zone, a default TTL,
+// files to include and the records grouped by name. TTLs are durations
+// like "5m" or seconds. A record has data, a list of values or both:
+//
+//	zone: example.com
+//	ttl: 1h
+//	include: [mail.yaml]
+//	records:
+//	  "@":
+//	    - {type: A, values: [192.0.2.1, 192.0.2.2]}
+//	  www:
+//	    - {type: CNAME, data: example.com., ttl: 5m}
+//
+// Included files are relative to the including file and have the same
+// format, but may leave out the zone. Their records use their own default
+// TTL, or else that of the including file.
+type ZoneConfig struct {
+	Zone string
+	// Source is the file the config was loaded from.
+	Source  string
+	Records []libdns.Record
+}
+
+type zoneConfigFile struct {
+	Zone    string                        `yaml:"zone"`
+	TTL     configTTL                     `yaml:"ttl"`
+	Include []string                      `yaml:"include"`
+	Records map[string][]zoneConfigRecord `yaml:"records"`
+}
+
+type zoneConfigRecord struct {
+	Type   string    `yaml:"type"`
+	TTL    configTTL `yaml:"ttl"`
+	Data   string    `yaml:"data"`
+	Values []string  `yaml:"values"`
+}
+
+// configTTL is a TTL given as a duration or as seconds.
+type configTTL time.Duration
+
+func (t *configTTL) UnmarshalYAML(value *yaml.Node) error {
+	var seconds int
+	if err := value.Decode(&seconds); err == nil {
+		*t = configTTL(time.Duration(seconds) * time.Second)
+		return nil
+	}
+	d, err := time.ParseDuration(value.Value)
+	if err != nil {
+		return fmt.Errorf("invalid ttl %q on line %d", value.Value, value.Line)
+	}
+	*t = configTTL(d)
+	return nil
+}
+
+// LoadZoneConfig reads a zone definition and the files it includes.
+func LoadZoneConfig(name string) (*ZoneConfig, error) {
+	cfg := &ZoneConfig{Source: name, Records: []libdns.Record{}}
+	if err := cfg.load(name, 0, nil); err != nil {
+		return nil, err
+	}
+	if cfg.Zone == "" {
+		return nil, fmt.Errorf("%s: no zone", name)
+	}
+	return cfg, nil
+}
+
+// load reads the file name into cfg. ttl is the default TTL of the
+// including file and parents the files including this one.
+func (cfg *ZoneConfig) load(name string, ttl time.Duration, parents []string) error {
+	abs, err := filepath.Abs(name)
+	if err != nil {
+		return err
+	}
+	if slices.Contains(parents, abs) {
+		return fmt.Errorf("%s: include cycle", name)
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	file, err := decodeZoneConfig(f)
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+
+	if zone := cleanZ(file.Zone); zone != "" {
+		if cfg.Zone != "" && !strings.EqualFold(zone, cfg.Zone) {
+			return fmt.Errorf("%s: zone %s, want %s", name, zone, cfg.Zone)
+		}
+		cfg.Zone = zone
+	} else if len(parents) == 0 {
+		return fmt.Errorf("%s: no zone", name)
+	}
+	if file.TTL != 0 {
+		ttl = time.Duration(file.TTL)
+	}
+	if ttl == 0 {
+		ttl = defaultConfigTTL
+	}
+
+	for _, include := range file.Include {
+		if !filepath.IsAbs(include) {
+			include = filepath.Join(filepath.Dir(name), include)
+		}
+		if err := cfg.load(include, ttl, append(parents, abs)); err != nil {
+			return err
+		}
+	}
+
+	names := make([]string, 0, len(file.Records))
+	for n := range file.Records {
+		names = append(names, n)
+	}
+	slices.Sort(names)
+	for _, n := range names {
+		for _, r := range file.Records[n] {
+			records, err := r.records(n, ttl)
+			if err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+			cfg.Records = append(cfg.Records, records...)
+		}
+	}
+	return nil
+}
+
+// decodeZoneConfig decodes a YAML or JSON zone definition. Unknown fields
+// are errors, so that typos are not silently ignored.
+func decodeZoneConfig(r io.Reader) (*zoneConfigFile, error) {
+	file := &zoneConfigFile{}
+	dec := yaml.NewDecoder(r)
+	dec.KnownFields(true)
+	if err := dec.Decode(file); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	return file, nil
+}
+
+// records returns a record for each value of r.
+func (r zoneConfigRecord) records(name string, ttl time.Duration) ([]libdns.Record, error) {
+	if r.TTL != 0 {
+		ttl = time.Duration(r.TTL)
+	}
+	typ := strings.ToUpper(r.Type)
+	if name == "" || typ == "" {
+		return nil, fmt.Errorf("record %q %q: name and type are required", name, r.Type)
+	}
+	values := r.Values
+	if r.Data != "" {
+		values = append([]string{r.Data}, values...)
+	}
+	if len(values) == 0 {
+		return nil, fmt.Errorf("%s %s: data or values are required", name, typ)
+	}
+	records := make([]libdns.Record, 0, len(values))
+	for _, v := range values {
+		record, err := libdns.RR{Name: name, Type: typ, TTL: ttl, Data: v}.Parse()
+		if err != nil {
+			return nil, fmt.Errorf("%s %s %q: %w", name, typ, v, err)
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// ZonePlan holds the changes that make a zone match a ZoneConfig. Get one
+// from PlanZoneConfig, review it with String and apply it with
+// ApplyZonePlan.
+type ZonePlan struct {
+	Zone string
+	// Diff is the RRset diff from the zone to the config. It shows
+	// exactly the changes ApplyZonePlan makes, with the data as it is
+	// stored at GleSYS.
+	Diff *ZoneDiff
+
+	changes changeSet
+	// records are the records of the zone the plan manages, as they were
+	// when it was made, and rrsets the RRsets of the config.
+	records []impl.DNSDomainRecord
+	rrsets  map[string]bool
+}
+
+// Empty returns true if the zone already matches the config.
+func (zp *ZonePlan) Empty() bool {
+	return zp.changes.empty()
+}
+
+// String shows the diff of the plan.
+func (zp *ZonePlan) String() string {
+	return zp.Diff.String()
+}
+
+// PlanZoneConfig compares the zone with the config and returns the
+// changes needed to make the zone match it, like SyncZone would make.
+// Nothing is changed. Like SyncZone, it fails with ErrTooManyDeletions
+// if the plan deletes more than MaxDeletions records.
+func (p *Provider) PlanZoneConfig(ctx context.Context, cfg *ZoneConfig) (*ZonePlan, error) {
+	ctx, span := p.startSpan(ctx, "PlanZoneConfig", cfg.Zone, cfg.Records)
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	plan, err := p.planZoneConfig(ctx, cfg)
+	endSpan(span, nil, err)
+	return plan, err
+}
+
+func (p *Provider) planZoneConfig(ctx context.Context, cfg *ZoneConfig) (*ZonePlan, error) {
+	zone := cleanZ(cfg.Zone)
+	if debug {
+		log.Printf("PlanZoneConfig zone=%s source=%s", zone, cfg.Source)
+	}
+	cs, managed, err := p.planSyncZone(ctx, zone, cfg.Records)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.checkDeletions(zone, cs); err != nil {
+		return nil, err
+	}
+	diff := diffChanges(managed, cs)
+	diff.From, diff.To = zone, cmp.Or(cfg.Source, "config")
+	return &ZonePlan{Zone: zone, Diff: diff, changes: cs, records: managed, rrsets: rrsetKeys(cfg.Records)}, nil
+}
+
+// diffChanges returns the RRset diff between the records and the records
+// after cs is applied to them. RRsets cs does not change are unchanged.
+func diffChanges(records []impl.DNSDomainRecord, cs changeSet) *ZoneDiff {
+	type rrset struct {
+		name, typ string
+		from, to  []impl.DNSDomainRecord
+	}
+	sets := map[string]*rrset{}
+	get := func(dr impl.DNSDomainRecord) *rrset {
+		key := nameTypeKey(dr.Host, dr.Type)
+		set, ok := sets[key]
+		if !ok {
+			set = &rrset{name: dr.Host, typ: strings.ToUpper(dr.Type)}
+			sets[key] = set
+		}
+		return set
+	}
+	for _, dr := range records {
+		get(dr).from = append(get(dr).from, dr)
+	}
+	changed := map[*rrset]bool{}
+	// the records after the changes, by ID for those that already exist
+	after := map[int]impl.DNSDomainRecord{}
+	for _, dr := range records {
+		after[dr.RecordID] = dr
+	}
+	for _, u := range cs.updates {
+		after[u.From.RecordID] = u.To
+		changed[get(u.From)] = true
+	}
+	for _, dr := range cs.deletes {
+		delete(after, dr.RecordID)
+		changed[get(dr)] = true
+	}
+	for _, dr := range records {
+		if to, ok := after[dr.RecordID]; ok {
+			get(dr).to = append(get(dr).to, to)
+		}
+	}
+	for _, dr := range cs.additions {
+		get(dr).to = append(get(dr).to, dr)
+		changed[get(dr)] = true
+	}
+
+	diffRecords := func(records []impl.DNSDomainRecord) []DiffRecord {
+		diff := make([]DiffRecord, 0, len(records))
+		for _, dr := range records {
+			diff = append(diff, DiffRecord{TTL: dr.TTL, Data: dr.Data})
+		}
+		slices.SortFunc(diff, func(a, b DiffRecord) int { return strings.Compare(a.Data, b.Data) })
+		return diff
+	}
+	d := &ZoneDiff{RRsets: []RRsetDiff{}}
+	for _, set := range sets {
+		if !changed[set] {
+			d.Unchanged++
+			continue
+		}
+		diff := RRsetDiff{Name: set.name, Type: set.typ, From: diffRecords(set.from), To: diffRecords(set.to), Change: DiffChanged}
+		switch {
+		case len(diff.From) == 0:
+			diff.Change = DiffAdded
+		case len(diff.To) == 0:
+			diff.Change = DiffRemoved
+		}
+		d.RRsets = append(d.RRsets, diff)
+	}
+	slices.SortFunc(d.RRsets, func(a, b RRsetDiff) int {
+		return cmp.Or(strings.Compare(a.Name, b.Name), strings.Compare(a.Type, b.Type))
+	})
+	return d
+}
+
+// ApplyZonePlan applies a plan from PlanZoneConfig like SyncZone does,
+// so it fails with ErrTooManyDeletions if the plan deletes more than
+// MaxDeletions records, and a failed apply is rolled back. It fails with
+// ErrPlanOutdated, changing nothing, if a record the plan manages was
+// added, changed or deleted since the plan was made.
+func (p *Provider) ApplyZonePlan(ctx context.Context, plan *ZonePlan) (*SyncReport, error) {
+	ctx, span := p.startSpan(ctx, "ApplyZonePlan", plan.Zone, nil)
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	report, err := p.applyZonePlan(ctx, plan)
+	endSpan(span, nil, err)
+	return report, err
+}
+
+func (p *Provider) applyZonePlan(ctx context.Context, plan *ZonePlan) (*SyncReport, error) {
+	if debug {
+		log.Printf("ApplyZonePlan zone=%s", plan.Zone)
+	}
+	managed := func(dr impl.DNSDomainRecord) bool { return !kept(dr, plan.rrsets) }
+	if err := p.checkOutdated(ctx, plan.Zone, plan.records, managed); err != nil {
+		return nil, err
+	}
+	return p.applySync(ctx, plan.Zone, plan.changes, SyncOptions{Mode: SyncAuthoritative})
+}
+
+// checkOutdated returns ErrPlanOutdated if the records of the zone that a
+// plan manages are no longer the records it was made from: one of them was
+// changed or deleted, or a record was added. managed tells which records
+// the plan manages, all of them if nil.
+func (p *Provider) checkOutdated(ctx context.Context, zone string, planned []impl.DNSDomainRecord, managed func(impl.DNSDomainRecord) bool) error {
+	existing, err := p.client().DNSDomains.ListRecords(ctx, zone)
+	if err != nil {
+		return err
+	}
+	byID := map[int]impl.DNSDomainRecord{}
+	for _, dr := range planned {
+		byID[dr.RecordID] = dr
+	}
+	for _, dr := range *existing {
+		if managed != nil && !managed(dr) {
+			continue
+		}
+		was, ok := byID[dr.RecordID]
+		if !ok {
+			return fmt.Errorf("%w: %s %s %s (record %d) was added", ErrPlanOutdated, dr.Host, dr.Type, dr.Data, dr.RecordID)
+		}
+		if !sameRecord(was, dr) {
+			return fmt.Errorf("%w: %s %s %s (record %d) was changed", ErrPlanOutdated, was.Host, was.Type, was.Data, dr.RecordID)
+		}
+		delete(byID, dr.RecordID)
+	}
+	for _, dr := range planned {
+		if _, ok := byID[dr.RecordID]; ok {
+			return fmt.Errorf("%w: %s %s %s (record %d) was deleted", ErrPlanOutdated, dr.Host, dr.Type, dr.Data, dr.RecordID)
+		}
+	}
+	return nil
+}
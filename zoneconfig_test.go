@@ -0,0 +1,339 @@
+// SPDX-FileCopyrightText: 2024 Peter Magnusson <me@kmpm.se>
+// SPDX-License-Identifier: MIT
+
+package glesys_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/libdns/glesys"
+	"github.com/libdns/glesys/glesystest"
+	"github.com/libdns/libdns"
+)
+
+// writeFiles writes the files to a temporary directory and returns it.
+func writeFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, data := range files {
+		name = filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(name, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+var zoneConfigFiles = map[string]string{
+	"example.com.yaml": `
+zone: example.com.
+ttl: 30m
+include: [shared/mail.yaml]
+records:
+  "@":
+    - {type: A, values: [192.0.2.1, 192.0.2.2]}
+  www:
+    - type: cname
+      data: example.com.
+      ttl: 300
+`,
+	"shared/mail.yaml": `
+ttl: 2h
+include: [spf.json]
+records:
+  "@":
+    - {type: MX, data: 10 mail.example.com.}
+`,
+	"shared/spf.json": `{"records": {"@": [{"type": "TXT", "data": "v=spf1 mx -all"}]}}`,
+}
+
+var zoneConfigRecords = []libdns.Record{
+	libdns.Address{Name: "@", TTL: 30 * time.Minute, IP: addr("@", "192.0.2.1").IP},
+	libdns.Address{Name: "@", TTL: 30 * time.Minute, IP: addr("@", "192.0.2.2").IP},
+	libdns.CNAME{Name: "www", TTL: 5 * time.Minute, Target: "example.com."},
+	libdns.MX{Name: "@", TTL: 2 * time.Hour, Preference: 10, Target: "mail.example.com."},
+	libdns.TXT{Name: "@", TTL: 2 * time.Hour, Text: "v=spf1 mx -all"},
+}
+
+func TestLoadZoneConfig(t *testing.T) {
+	dir := writeFiles(t, zoneConfigFiles)
+	name := filepath.Join(dir, "example.com.yaml")
+
+	cfg, err := glesys.LoadZoneConfig(name)
+	if err != nil {
+		t.Fatalf("LoadZoneConfig() error = %v", err)
+	}
+
+	if cfg.Zone != "example.com" || cfg.Source != name {
+		t.Errorf("LoadZoneConfig() zone = %q, source = %q", cfg.Zone, cfg.Source)
+	}
+	assertRecords(t, "LoadZoneConfig()", cfg.Records, zoneConfigRecords...)
+	assertTyped(t, "LoadZoneConfig()", cfg.Records)
+}
+
+func TestLoadZoneConfigDefaultTTL(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"zone.json": `{"zone": "example.com", "records": {"www": [{"type": "AAAA", "data": "2001:db8::1"}]}}`,
+	})
+
+	cfg, err := glesys.LoadZoneConfig(filepath.Join(dir, "zone.json"))
+	if err != nil {
+		t.Fatalf("LoadZoneConfig() error = %v", err)
+	}
+
+	assertRecords(t, "LoadZoneConfig()", cfg.Records,
+		libdns.RR{Name: "www", TTL: time.Hour, Type: "AAAA", Data: "2001:db8::1"})
+}
+
+func TestLoadZoneConfigErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		want  string
+	}{
+		{"no_zone", map[string]string{"zone.yaml": "records: {}"}, "no zone"},
+		{"unknown_field", map[string]string{"zone.yaml": "zone: example.com\nrecrods: {}"}, "recrods"},
+		{"bad_ttl", map[string]string{"zone.yaml": "zone: example.com\nttl: soon"}, `invalid ttl "soon"`},
+		{"no_data", map[string]string{"zone.yaml": "zone: example.com\nrecords: {www: [{type: A}]}"}, "www A: data or values are required"},
+		{"no_type", map[string]string{"zone.yaml": "zone: example.com\nrecords: {www: [{data: 192.0.2.1}]}"}, "name and type are required"},
+		{"bad_data", map[string]string{"zone.yaml": "zone: example.com\nrecords: {www: [{type: A, data: nope}]}"}, `www A "nope"`},
+		{"missing_include", map[string]string{"zone.yaml": "zone: example.com\ninclude: [mail.yaml]"}, "mail.yaml"},
+		{"include_cycle", map[string]string{
+			"zone.yaml": "zone: example.com\ninclude: [a.yaml]",
+			"a.yaml":    "include: [b.yaml]",
+			"b.yaml":    "include: [a.yaml]",
+		}, "a.yaml: include cycle"},
+		{"other_zone", map[string]string{
+			"zone.yaml":  "zone: example.com\ninclude: [other.yaml]",
+			"other.yaml": "zone: example.org",
+		}, "zone example.org, want example.com"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := writeFiles(t, tt.files)
+
+			_, err := glesys.LoadZoneConfig(filepath.Join(dir, "zone.yaml"))
+
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("LoadZoneConfig() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestProvider_PlanAndApplyZoneConfig(t *testing.T) {
+	s := glesystest.NewServer()
+	defer s.Close()
+	s.AddZone("example.com", syncZoneInitial...)
+	p := s.Provider()
+	ctx := context.Background()
+	cfg := &glesys.ZoneConfig{Zone: "example.com", Source: "example.com.yaml", Records: zoneConfigRecords}
+	counter := s.Inject()
+
+	plan, err := p.PlanZoneConfig(ctx, cfg)
+	if err != nil {
+		t.Fatalf("PlanZoneConfig() error = %v", err)
+	}
+
+	for _, endpoint := range mutatingEndpoints {
+		if n := counter.Count(endpoint); n != 0 {
+			t.Errorf("PlanZoneConfig() made %d %s calls", n, endpoint)
+		}
+	}
+	if plan.Empty() {
+		t.Fatal("PlanZoneConfig() returned an empty plan")
+	}
+	want := "--- example.com\n+++ example.com.yaml\n" +
+		"+ @ 1800 A 192.0.2.1\n" +
+		"+ @ 1800 A 192.0.2.2\n" +
+		"~ @ 3600 -> 7200 MX 10 mail.example.com.\n" +
+		"+ @ 7200 TXT v=spf1 mx -all\n" +
+		"- stale 3600 TXT a\n" +
+		"- stale 3600 TXT b\n" +
+		"- www 3600 A 192.0.2.1\n" +
+		"- www 3600 A 192.0.2.2\n" +
+		"+ www 300 CNAME example.com.\n"
+	if got := plan.String(); got != want {
+		t.Errorf("String() =\n%s\nwant\n%s", got, want)
+	}
+
+	report, err := p.ApplyZonePlan(ctx, plan)
+	if err != nil {
+		t.Fatalf("ApplyZonePlan() error = %v", err)
+	}
+	if len(report.Deleted) != 4 {
+		t.Errorf("ApplyZonePlan() deleted %v", report.Deleted)
+	}
+	// the apex NS records are not in the config and are kept
+	assertZone(t, s, append(syncZoneInitial[:2:2], zoneConfigRecords...)...)
+
+	again, err := p.PlanZoneConfig(ctx, cfg)
+	if err != nil {
+		t.Fatalf("repeated PlanZoneConfig() error = %v", err)
+	}
+	if !again.Empty() || !again.Diff.Empty() {
+		t.Errorf("Repeated PlanZoneConfig() is not empty:\n%s", again)
+	}
+}
+
+func TestProvider_ApplyZonePlanMaxDeletions(t *testing.T) {
+	s := glesystest.NewServer()
+	defer s.Close()
+	s.AddZone("example.com", syncZoneInitial...)
+	p := s.Provider()
+	ctx := context.Background()
+	plan, err := p.PlanZoneConfig(ctx, &glesys.ZoneConfig{Zone: "example.com", Records: zoneConfigRecords})
+	if err != nil {
+		t.Fatal(err)
+	}
+	before := zoneState(s, "example.com")
+	p.MaxDeletions = 3
+
+	_, err = p.ApplyZonePlan(ctx, plan)
+
+	if !errors.Is(err, glesys.ErrTooManyDeletions) {
+		t.Errorf("ApplyZonePlan() error = %v, want ErrTooManyDeletions", err)
+	}
+	if after := zoneState(s, "example.com"); !reflect.DeepEqual(after, before) {
+		t.Errorf("Zone changed to %v", after)
+	}
+}
+
+func TestProvider_PlanZoneConfigShowsAppliedChanges(t *testing.T) {
+	s := glesystest.NewServer()
+	defer s.Close()
+	s.AddZone("example.com",
+		libdns.CNAME{Name: "www", TTL: time.Hour, Target: "Example.com."},
+		libdns.TXT{Name: "@", TTL: time.Hour, Text: "same"},
+	)
+	p := s.Provider()
+	ctx := context.Background()
+	// the targets only differ in case, which GleSYS stores as given
+	cfg := &glesys.ZoneConfig{Zone: "example.com", Records: []libdns.Record{
+		libdns.CNAME{Name: "www", TTL: time.Hour, Target: "example.com."},
+		libdns.TXT{Name: "@", TTL: time.Hour, Text: "same"},
+	}}
+
+	plan, err := p.PlanZoneConfig(ctx, cfg)
+	if err != nil {
+		t.Fatalf("PlanZoneConfig() error = %v", err)
+	}
+
+	want := "--- example.com\n+++ config\n" +
+		"- www 3600 CNAME Example.com.\n" +
+		"+ www 3600 CNAME example.com.\n"
+	if plan.Empty() || plan.String() != want {
+		t.Errorf("String() =\n%s\nwant\n%s", plan, want)
+	}
+	if plan.Diff.Unchanged != 1 {
+		t.Errorf("Unchanged = %d, want 1", plan.Diff.Unchanged)
+	}
+	report, err := p.ApplyZonePlan(ctx, plan)
+	if err != nil {
+		t.Fatalf("ApplyZonePlan() error = %v", err)
+	}
+	if len(report.Updated) != 1 {
+		t.Errorf("ApplyZonePlan() = %v", report)
+	}
+	assertZone(t, s, cfg.Records...)
+}
+
+func TestProvider_ApplyZonePlanOutdated(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(p *glesys.Provider) error
+	}{
+		{"deleted", func(p *glesys.Provider) error {
+			_, err := p.DeleteRecords(context.Background(), "example.com", []libdns.Record{libdns.TXT{Name: "stale", Text: "a"}})
+			return err
+		}},
+		{"changed", func(p *glesys.Provider) error {
+			_, err := p.SetRecords(context.Background(), "example.com", []libdns.Record{
+				libdns.MX{Name: "@", TTL: time.Minute, Preference: 10, Target: "mail.example.com."},
+			})
+			return err
+		}},
+		{"planned_addition_added", func(p *glesys.Provider) error {
+			_, err := p.AppendRecords(context.Background(), "example.com", []libdns.Record{
+				libdns.TXT{Name: "@", TTL: 2 * time.Hour, Text: "v=spf1 mx -all"},
+			})
+			return err
+		}},
+		{"managed_rrset_added", func(p *glesys.Provider) error {
+			_, err := p.AppendRecords(context.Background(), "example.com", []libdns.Record{addr("@", "192.0.2.9")})
+			return err
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := glesystest.NewServer()
+			defer s.Close()
+			s.AddZone("example.com", syncZoneInitial...)
+			p := s.Provider()
+			ctx := context.Background()
+			plan, err := p.PlanZoneConfig(ctx, &glesys.ZoneConfig{Zone: "example.com", Records: zoneConfigRecords})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := tt.change(p); err != nil {
+				t.Fatal(err)
+			}
+			before := zoneState(s, "example.com")
+
+			_, err = p.ApplyZonePlan(ctx, plan)
+
+			if !errors.Is(err, glesys.ErrPlanOutdated) {
+				t.Errorf("ApplyZonePlan() error = %v, want ErrPlanOutdated", err)
+			}
+			if after := zoneState(s, "example.com"); !reflect.DeepEqual(after, before) {
+				t.Errorf("Zone changed to %v", after)
+			}
+		})
+	}
+}
+
+func TestProvider_PlanZoneConfigMaxDeletions(t *testing.T) {
+	s := glesystest.NewServer()
+	defer s.Close()
+	s.AddZone("example.com", syncZoneInitial...)
+	p := s.Provider()
+	p.MaxDeletions = 3
+
+	_, err := p.PlanZoneConfig(context.Background(), &glesys.ZoneConfig{Zone: "example.com", Records: zoneConfigRecords})
+
+	if !errors.Is(err, glesys.ErrTooManyDeletions) {
+		t.Errorf("PlanZoneConfig() error = %v, want ErrTooManyDeletions", err)
+	}
+}
+
+func TestProvider_ApplyZonePlanKeepsNewProtectedRecords(t *testing.T) {
+	s := glesystest.NewServer()
+	defer s.Close()
+	s.AddZone("example.com", syncZoneInitial...)
+	p := s.Provider()
+	ctx := context.Background()
+	plan, err := p.PlanZoneConfig(ctx, &glesys.ZoneConfig{Zone: "example.com", Records: zoneConfigRecords})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the plan does not manage the apex NS records
+	ns3 := libdns.NS{Name: "@", TTL: time.Hour, Target: "ns3.namesystem.se."}
+	if _, err := p.AppendRecords(ctx, "example.com", []libdns.Record{ns3}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := p.ApplyZonePlan(ctx, plan); err != nil {
+		t.Fatalf("ApplyZonePlan() error = %v", err)
+	}
+	assertZone(t, s, append(append(syncZoneInitial[:2:2], ns3), zoneConfigRecords...)...)
+}
@@ -0,0 +1,177 @@
+// SPDX-FileCopyrightText: 2024 Peter Magnusson <me@kmpm.se>
+// SPDX-License-Identifier: MIT
+
+package glesys
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/libdns/glesys/internal/impl"
+	"github.com/libdns/libdns"
+)
+
+// Zone holds the details GleSYS keeps about a zone.
+type Zone struct {
+	Name       string
+	CreateTime time.Time
+
+	SOA
+
+	RecordCount int
+
+	// UsingGlesysNameserver is true if the domain is delegated to the
+	// GleSYS name servers.
+	UsingGlesysNameserver bool
+
+	// Registration is only set for domains registered through GleSYS.
+	Registration *Registration
+}
+
+// Registration holds the registrar information of a domain registered
+// through GleSYS.
+type Registration struct {
+	State            string
+	StateDescription string
+	AutoRenew        bool
+	// Expires is the date the registration expires.
+	Expires time.Time
+	TLD     string
+}
+
+// CreateZoneOptions are optional settings for CreateZone. Zero values
+// leave the GleSYS defaults in place.
+type CreateZoneOptions struct {
+	// SkipDefaultRecords creates the zone without the records GleSYS
+	// adds to new zones by default.
+	SkipDefaultRecords bool
+
+	SOA
+}
+
+// toZone converts a GleSYS DNSDomain to a Zone.
+func toZone(d *impl.DNSDomain) *Zone {
+	z := &Zone{
+		Name:                  d.Name,
+		SOA:                   toSOA(d),
+		RecordCount:           d.RecordCount,
+		UsingGlesysNameserver: d.UsingGlesysNameserver == "yes",
+	}
+	// times GleSYS can not give are left as zero values
+	z.CreateTime, _ = time.Parse(time.RFC3339, d.CreateTime)
+	if ri := d.RegistrarInfo; ri.State != "" {
+		z.Registration = &Registration{
+			State:            ri.State,
+			StateDescription: ri.StateDescription,
+			AutoRenew:        ri.AutoRenew == "yes",
+			TLD:              ri.TLD,
+		}
+		z.Registration.Expires, _ = time.Parse(time.DateOnly, ri.Expire)
+	}
+	return z
+}
+
+// CreateZone adds the zone to the GleSYS account and returns its details.
+// The domain does not have to be registered through GleSYS.
+func (p *Provider) CreateZone(ctx context.Context, zone string, opts CreateZoneOptions) (*Zone, error) {
+	ctx, span := p.startSpan(ctx, "CreateZone", zone, nil)
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	z, err := p.createZone(ctx, zone, opts)
+	endSpan(span, nil, err)
+	return z, err
+}
+
+func (p *Provider) createZone(ctx context.Context, zone string, opts CreateZoneOptions) (*Zone, error) {
+	zone = cleanZ(zone)
+	if debug {
+		log.Printf("CreateZone zone=%s", zone)
+	}
+	if err := opts.SOA.Validate(); err != nil {
+		return nil, err
+	}
+	params := impl.AddDNSDomainParams{
+		Name:              zone,
+		PrimaryNameServer: opts.PrimaryNameServer,
+		ResponsiblePerson: opts.ResponsiblePerson,
+		TTL:               int(opts.TTL / time.Second),
+		Refresh:           int(opts.Refresh / time.Second),
+		Retry:             int(opts.Retry / time.Second),
+		Expire:            int(opts.Expire / time.Second),
+		Minimum:           int(opts.Minimum / time.Second),
+	}
+	if opts.SkipDefaultRecords {
+		params.CreateRecords = "no"
+	}
+	d, err := p.client().DNSDomains.AddDNSDomain(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+	return toZone(d), nil
+}
+
+// ZoneDetails returns the details of the zone.
+func (p *Provider) ZoneDetails(ctx context.Context, zone string) (*Zone, error) {
+	ctx, span := p.startSpan(ctx, "ZoneDetails", zone, nil)
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	z, err := p.zoneDetails(ctx, zone)
+	endSpan(span, nil, err)
+	return z, err
+}
+
+func (p *Provider) zoneDetails(ctx context.Context, zone string) (*Zone, error) {
+	zone = cleanZ(zone)
+	if debug {
+		log.Printf("ZoneDetails zone=%s", zone)
+	}
+	d, err := p.client().DNSDomains.Details(ctx, zone)
+	if err != nil {
+		return nil, err
+	}
+	return toZone(d), nil
+}
+
+// DeleteZone removes the zone and all its records from the GleSYS account.
+// GleSYS refuses to delete a zone that still has email accounts.
+func (p *Provider) DeleteZone(ctx context.Context, zone string) error {
+	ctx, span := p.startSpan(ctx, "DeleteZone", zone, nil)
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	zone = cleanZ(zone)
+	if debug {
+		log.Printf("DeleteZone zone=%s", zone)
+	}
+	err := p.client().DNSDomains.Delete(ctx, impl.DeleteDNSDomainParams{Name: zone})
+	endSpan(span, nil, err)
+	return err
+}
+
+// ListZones lists the zones in the GleSYS account.
+func (p *Provider) ListZones(ctx context.Context) ([]libdns.Zone, error) {
+	ctx, span := p.startSpan(ctx, "ListZones", "", nil)
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	zones, err := p.listZones(ctx)
+	endSpan(span, nil, err)
+	return zones, err
+}
+
+func (p *Provider) listZones(ctx context.Context) ([]libdns.Zone, error) {
+	if debug {
+		log.Printf("ListZones")
+	}
+	domains, err := p.client().DNSDomains.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	zones := make([]libdns.Zone, 0, len(*domains))
+	for _, d := range *domains {
+		zones = append(zones, libdns.Zone{Name: d.Name + "."})
+	}
+	return zones, nil
+}
+
+// Interface guards
+var _ libdns.ZoneLister = (*Provider)(nil)
@@ -0,0 +1,139 @@
+// SPDX-FileCopyrightText: 2024 Peter Magnusson <me@kmpm.se>
+// SPDX-License-Identifier: MIT
+
+package glesys_test
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/libdns/glesys"
+	"github.com/libdns/glesys/glesystest"
+	"github.com/libdns/libdns"
+)
+
+func TestProvider_CreateZone(t *testing.T) {
+	tests := []struct {
+		name        string
+		opts        glesys.CreateZoneOptions
+		wantRecords int
+		wantTTL     time.Duration
+		wantNS      string
+	}{
+		{"defaults", glesys.CreateZoneOptions{}, 3, time.Hour, "ns1.namesystem.se."},
+		{"skip_default_records", glesys.CreateZoneOptions{SkipDefaultRecords: true}, 0, time.Hour, "ns1.namesystem.se."},
+		{"soa", glesys.CreateZoneOptions{SOA: glesys.SOA{TTL: 5 * time.Minute, PrimaryNameServer: "ns.example.net."}}, 3, 5 * time.Minute, "ns.example.net."},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := glesystest.NewServer()
+			defer s.Close()
+
+			z, err := s.Provider().CreateZone(context.Background(), "example.com.", tt.opts)
+
+			if err != nil {
+				t.Fatalf("CreateZone() error = %v", err)
+			}
+			if z.Name != "example.com" || z.TTL != tt.wantTTL || z.PrimaryNameServer != tt.wantNS || z.RecordCount != tt.wantRecords {
+				t.Errorf("CreateZone() = %+v", z)
+			}
+			if z.Registration != nil {
+				t.Errorf("CreateZone() of an unregistered domain has registration %+v", z.Registration)
+			}
+			if got := len(s.Records("example.com")); got != tt.wantRecords {
+				t.Errorf("Zone has %d records, want %d", got, tt.wantRecords)
+			}
+		})
+	}
+}
+
+func TestProvider_CreateZoneExists(t *testing.T) {
+	s := glesystest.NewServer()
+	defer s.Close()
+	s.AddZone("example.com")
+
+	_, err := s.Provider().CreateZone(context.Background(), "example.com", glesys.CreateZoneOptions{})
+
+	if err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Errorf("CreateZone() error = %v, want already exists", err)
+	}
+}
+
+func TestProvider_ZoneDetails(t *testing.T) {
+	s := glesystest.NewServer()
+	defer s.Close()
+	s.AddZone("example.com", addr("www", "192.0.2.1"))
+	p := s.Provider()
+
+	z, err := p.ZoneDetails(context.Background(), "example.com.")
+
+	if err != nil {
+		t.Fatalf("ZoneDetails() error = %v", err)
+	}
+	want := glesys.Zone{
+		Name: "example.com",
+		SOA: glesys.SOA{
+			PrimaryNameServer: "ns1.namesystem.se.",
+			ResponsiblePerson: "registry.glesys.se.",
+			TTL:               time.Hour,
+			Refresh:           3 * time.Hour,
+			Retry:             45 * time.Minute,
+			Expire:            21 * 24 * time.Hour,
+			Minimum:           3 * time.Hour,
+		},
+		RecordCount:           1,
+		UsingGlesysNameserver: true,
+	}
+	got := *z
+	if got.CreateTime.IsZero() || got.Registration == nil || got.Registration.Expires.IsZero() {
+		t.Errorf("ZoneDetails() did not parse the dates: %+v %+v", got, got.Registration)
+	}
+	if got.Registration != nil && (got.Registration.State != "OK" || !got.Registration.AutoRenew || got.Registration.TLD != "com") {
+		t.Errorf("ZoneDetails() registration = %+v", got.Registration)
+	}
+	got.CreateTime, got.Registration = time.Time{}, nil
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ZoneDetails() = %+v, want %+v", got, want)
+	}
+
+	if _, err := p.ZoneDetails(context.Background(), "example.org"); err == nil || !strings.Contains(err.Error(), "Domain not found") {
+		t.Errorf("ZoneDetails() of a missing zone error = %v", err)
+	}
+}
+
+func TestProvider_DeleteZone(t *testing.T) {
+	s := glesystest.NewServer()
+	defer s.Close()
+	s.AddZone("example.com", addr("www", "192.0.2.1"))
+	p := s.Provider()
+
+	if err := p.DeleteZone(context.Background(), "example.com."); err != nil {
+		t.Fatalf("DeleteZone() error = %v", err)
+	}
+	if s.Records("example.com") != nil {
+		t.Errorf("Zone still exists after DeleteZone()")
+	}
+	if err := p.DeleteZone(context.Background(), "example.com"); err == nil || !strings.Contains(err.Error(), "Domain not found") {
+		t.Errorf("DeleteZone() of a missing zone error = %v", err)
+	}
+}
+
+func TestProvider_ListZones(t *testing.T) {
+	s := glesystest.NewServer()
+	defer s.Close()
+	s.AddZone("example.org")
+	s.AddZone("example.com")
+
+	got, err := s.Provider().ListZones(context.Background())
+
+	if err != nil {
+		t.Fatalf("ListZones() error = %v", err)
+	}
+	want := []libdns.Zone{{Name: "example.com."}, {Name: "example.org."}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ListZones() = %v, want %v", got, want)
+	}
+}